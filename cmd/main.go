@@ -17,7 +17,9 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
@@ -28,11 +30,11 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 
-	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
@@ -65,6 +67,7 @@ func main() {
 	var secureMetrics bool
 	var enableHTTP2 bool
 	var version bool
+	var reportRevisions bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
@@ -75,6 +78,8 @@ func main() {
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
 	flag.BoolVar(&version, "version", false, "Print the version of the tool")
+	flag.BoolVar(&reportRevisions, "report-revisions", false,
+		"Print what still uses each installed istio revision as JSON, and exit")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -88,6 +93,14 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if reportRevisions {
+		if err := printRevisionReport(); err != nil {
+			setupLog.Error(err, "unable to report istio revisions")
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	cfg, err := config.GetConfig()
 	if err != nil {
 		setupLog.Error(err, "unable to load config")
@@ -142,16 +155,10 @@ func main() {
 		os.Exit(1)
 	}
 
-	kubeClient, err := kubernetes.NewForConfig(mgr.GetConfig())
-	if err != nil {
-		panic(err.Error())
-	}
-
 	if err = (&controller.NamespaceReconciler{
-		Client:     mgr.GetClient(),
-		Scheme:     mgr.GetScheme(),
-		Config:     cfg,
-		KubeClient: kubeClient,
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Config: cfg,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Namespace")
 		os.Exit(1)
@@ -173,3 +180,19 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// printRevisionReport prints the revision report, reading straight from the API server
+func printRevisionReport() error {
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	var reporter = &controller.RevisionReporter{Client: c, Mapper: c.RESTMapper(), Uncached: true}
+	report, err := reporter.Report(context.Background())
+	if err != nil {
+		return err
+	}
+	var encoder = json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -0,0 +1,186 @@
+// Package advisory matches istio proxy versions against a local file of security advisories, so
+// vulnerable sidecars can be found and replaced first. The file is YAML or JSON, like:
+//
+//	advisories:
+//	  - id: ISTIO-SECURITY-2025-001
+//	    severity: critical
+//	    versions: ["1.22.0", "1.22.1"]
+//	    ranges:
+//	      - introduced: "1.23.0"
+//	        fixed: "1.23.3"
+//
+// Versions without a patch number, like "1.21", match every patch of that minor version.
+package advisory
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/hercynium/istio-fortsa/internal/version"
+)
+
+// Severity of an advisory
+type Severity string
+
+const (
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+// Rank orders severities, from 1 for low up to 4 for critical, and 0 for unknown ones
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityLow:
+		return 1
+	case SeverityMedium:
+		return 2
+	case SeverityHigh:
+		return 3
+	case SeverityCritical:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// Range is a range of affected versions, from introduced up to but not including fixed. Either
+// end can be left out.
+type Range struct {
+	Introduced string `json:"introduced,omitempty"`
+	Fixed      string `json:"fixed,omitempty"`
+}
+
+// Advisory lists the proxy versions affected by a vulnerability
+type Advisory struct {
+	ID       string   `json:"id"`
+	Severity Severity `json:"severity"`
+	Versions []string `json:"versions,omitempty"`
+	Ranges   []Range  `json:"ranges,omitempty"`
+}
+
+// Matches returns true if the proxy version is affected by the advisory. A version without a patch
+// number, like one read from a revision name, is taken to be its .0 release.
+func (a Advisory) Matches(v version.Version) bool {
+	if !v.HasPatch {
+		v.Patch, v.HasPatch = 0, true
+	}
+	for _, s := range a.Versions {
+		if affected, ok := version.Parse(s); ok && v.Compare(affected) == 0 {
+			return true
+		}
+	}
+	for _, r := range a.Ranges {
+		if introduced, ok := version.Parse(r.Introduced); ok && v.Compare(introduced) < 0 {
+			continue
+		}
+		if fixed, ok := version.Parse(r.Fixed); ok && v.Compare(fixed) >= 0 {
+			continue
+		}
+		if r.Introduced != "" || r.Fixed != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Set is the advisories in a file
+type Set struct {
+	Advisories []Advisory `json:"advisories"`
+}
+
+// Parse parses advisories from YAML or JSON
+func Parse(data []byte) (*Set, error) {
+	var set Set
+	if err := yaml.UnmarshalStrict(data, &set); err != nil {
+		return nil, err
+	}
+	for i, a := range set.Advisories {
+		if a.ID == "" {
+			return nil, fmt.Errorf("advisory %d has no id", i)
+		}
+		set.Advisories[i].Severity = Severity(strings.ToLower(string(a.Severity)))
+		if set.Advisories[i].Severity.Rank() == 0 {
+			return nil, fmt.Errorf("advisory %v has unknown severity %q", a.ID, a.Severity)
+		}
+		for _, s := range a.Versions {
+			if _, ok := version.Parse(s); !ok {
+				return nil, fmt.Errorf("advisory %v has invalid version %q", a.ID, s)
+			}
+		}
+		for _, r := range a.Ranges {
+			for _, s := range []string{r.Introduced, r.Fixed} {
+				if _, ok := version.Parse(s); s != "" && !ok {
+					return nil, fmt.Errorf("advisory %v has invalid version %q", a.ID, s)
+				}
+			}
+		}
+	}
+	return &set, nil
+}
+
+// Match returns the advisories affecting the proxy version, the most severe first
+func (s *Set) Match(v version.Version) []Advisory {
+	if s == nil {
+		return nil
+	}
+	var matched []Advisory
+	for _, a := range s.Advisories {
+		if a.Matches(v) {
+			matched = append(matched, a)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].Severity.Rank() > matched[j].Severity.Rank() })
+	return matched
+}
+
+// File is an advisory file, read again whenever it changes, as when it's mounted from a ConfigMap.
+// It is safe for concurrent use.
+type File struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	set     *Set
+}
+
+// NewFile returns the advisory file at the path, after checking that it can be read
+func NewFile(path string) (*File, error) {
+	var f = &File{path: path}
+	if _, err := f.Current(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Current returns the file's advisories, reading it again if it's changed. If it can't be read
+// anymore, the advisories read last are returned along with the error.
+func (f *File) Current() (*Set, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return f.set, err
+	}
+	if f.set != nil && info.ModTime().Equal(f.modTime) {
+		return f.set, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return f.set, err
+	}
+	set, err := Parse(data)
+	if err != nil {
+		return f.set, fmt.Errorf("invalid advisory file %v: %w", f.path, err)
+	}
+	f.set, f.modTime = set, info.ModTime()
+	return set, nil
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package advisory
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/hercynium/istio-fortsa/internal/version"
+)
+
+var _ = Describe("Advisories", func() {
+	var set *Set
+
+	BeforeEach(func() {
+		var err error
+		set, err = Parse([]byte(`
+advisories:
+  - id: ISTIO-SECURITY-2025-001
+    severity: High
+    versions: ["1.22.0", "1.21"]
+  - id: ISTIO-SECURITY-2025-002
+    severity: critical
+    ranges:
+      - introduced: "1.22.0"
+        fixed: "1.22.3"
+`))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	match := func(s string) []string {
+		v, ok := version.Parse(s)
+		Expect(ok).To(BeTrue())
+		var ids []string
+		for _, a := range set.Match(v) {
+			ids = append(ids, a.ID)
+		}
+		return ids
+	}
+
+	It("should match listed versions and ranges, the most severe first", func() {
+		Expect(match("1.22.0")).To(Equal([]string{"ISTIO-SECURITY-2025-002", "ISTIO-SECURITY-2025-001"}))
+		Expect(match("1.22.2")).To(Equal([]string{"ISTIO-SECURITY-2025-002"}))
+		Expect(match("1.21.6")).To(Equal([]string{"ISTIO-SECURITY-2025-001"}))
+		Expect(match("1.22.3")).To(BeEmpty())
+	})
+
+	It("should take versions without a patch number to be their .0 release", func() {
+		Expect(match("1-22")).To(Equal([]string{"ISTIO-SECURITY-2025-002", "ISTIO-SECURITY-2025-001"}))
+		Expect(match("1-21")).To(Equal([]string{"ISTIO-SECURITY-2025-001"}))
+		Expect(match("1-23")).To(BeEmpty())
+	})
+
+	It("should reject advisories with unknown severities", func() {
+		_, err := Parse([]byte(`{"advisories": [{"id": "X", "severity": "dire", "versions": ["1.22.0"]}]}`))
+		Expect(err).To(HaveOccurred())
+	})
+})
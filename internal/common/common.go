@@ -6,4 +6,19 @@ const (
 
 	// k8s object label for istio revision tag
 	IstioTagLabel = "istio.io/tag"
+
+	// namespace annotation overriding how fortsa restarts outdated pods in that namespace
+	RestartStrategyAnnotation = "fortsa.scaffidi.net/restart-strategy"
+
+	// namespace annotation allowing fortsa to delete outdated pods that have no controller
+	BarePodDeletionAnnotation = "fortsa.scaffidi.net/delete-bare-pods"
+
+	// namespace annotation allowing fortsa to restart pods onto an older istio version
+	AllowDowngradeAnnotation = "fortsa.scaffidi.net/allow-downgrade"
+
+	// workload or pod annotation with an integer priority. Higher priorities are restarted first.
+	PriorityAnnotation = "fortsa.scaffidi.net/priority"
+
+	// namespace label with the integer wave the namespace's pods are restarted in
+	WaveLabel = "fortsa.scaffidi.net/wave"
 )
@@ -1,11 +1,93 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
+// ways fortsa can restart outdated pods
+const (
+	// patch the pods' controller to trigger a rollout restart
+	RestartStrategyRollout = "rollout"
+
+	// evict the outdated pods through the Eviction API, honouring PodDisruptionBudgets
+	RestartStrategyEvict = "evict"
+)
+
+// what to do with pods whose sidecars would be upgraded by a restart
+const (
+	// restart them
+	UpgradePolicyRestart = "restart"
+
+	// leave them alone, and only report them
+	UpgradePolicySkip = "skip"
+)
+
+// criteria outdated pods can be ordered by, for RestartOrder
+const (
+	// orphaned proxies first, when PrioritizeOrphanedProxies is set
+	RestartOrderOrphaned = "orphaned"
+
+	// sidecars affected by the most severe advisories first
+	RestartOrderAdvisory = "advisory"
+
+	// sidecars furthest out of the supported skew first
+	RestartOrderSkew = "skew"
+
+	// highest fortsa.scaffidi.net/priority annotation on the workload or pod first
+	RestartOrderPriority = "priority"
+
+	// pods of the highest PriorityClass first
+	RestartOrderPriorityClass = "priorityClass"
+
+	// gateway pods after all others
+	RestartOrderGatewaysLast = "gatewaysLast"
+)
+
+// WorkloadKind describes a kind of pod controller, beyond the built-in ones, that fortsa can
+// restart by annotating its pod template. These can only be set in the config file.
+type WorkloadKind struct {
+	Group   string
+	Version string
+	Kind    string
+
+	// dot-separated path to the pod template's annotations. Defaults to
+	// spec.template.metadata.annotations
+	AnnotationsPath string
+
+	// how to tell when a rollout is complete. If empty, rollouts aren't tracked.
+	Completion WorkloadCompletion
+}
+
+// WorkloadCompletion describes the status fields that signal a workload's rollout is complete.
+// All fields are dot-separated paths into the object, and every configured check has to pass.
+type WorkloadCompletion struct {
+	// field that must be at least metadata.generation, e.g. status.observedGeneration
+	ObservedGenerationPath string
+
+	// fields that must all have the same value, e.g. [status.updatedReplicas, spec.replicas]
+	EqualFields []string
+
+	// fields that must have a specific value, e.g. status.phase = Healthy
+	ExpectedFields []ExpectedField
+}
+
+// ExpectedField is a field that must have a specific value
+type ExpectedField struct {
+	Path  string
+	Value string
+}
+
+// IsTracked returns true if any completion checks are configured
+func (c WorkloadCompletion) IsTracked() bool {
+	return c.ObservedGenerationPath != "" || len(c.EqualFields) > 0 || len(c.ExpectedFields) > 0
+}
+
 type FortsaConfig struct {
 	// don't restart pods, only report what would be done
 	DryRun bool
@@ -15,28 +97,206 @@ type FortsaConfig struct {
 
 	// rate-limit to this many simultaneous active restarts
 	ActiveRestartLimit int
+
+	// delete outdated pods of StatefulSets and DaemonSets using the OnDelete update strategy,
+	// one at a time, since a rollout restart doesn't replace their pods
+	OnDeletePodRestart bool
+
+	// how to restart outdated pods, unless overridden by a namespace annotation. One of
+	// "rollout" or "evict"
+	RestartStrategy string
+
+	// when evicting, allow no more than this many outdated pods to be terminating at once
+	MaxConcurrentEvictions int
+
+	// reconcile up to this many namespaces at once. Restarts are still limited cluster-wide by
+	// RestartsPerMinute and ActiveRestartLimit.
+	MaxConcurrentReconciles int
+
+	// restart pods whose sidecars are from an istio revision that's been uninstalled ahead of
+	// all other outdated pods
+	PrioritizeOrphanedProxies bool
+
+	// restart pods onto an older istio version than their sidecars have. Otherwise it has to be
+	// allowed per namespace with an annotation.
+	AllowDowngrades bool
+
+	// what to do with pods whose sidecars would move to a new minor (or major) or patch version
+	// of istio. One of "restart" or "skip"
+	MinorUpgradePolicy string
+	PatchUpgradePolicy string
+
+	// how many minor versions sidecars may be behind the control plane they connect to. Pods
+	// with sidecars further behind, or ahead of it at all, are reported and restarted first.
+	MaxProxySkew int
+
+	// path of a YAML or JSON file listing istio proxy versions with known vulnerabilities. Pods
+	// with vulnerable sidecars are reported and restarted first. Empty disables this.
+	AdvisoryFile string
+
+	// restart pods with sidecars affected by critical advisories without waiting on
+	// RestartsPerMinute or ActiveRestartLimit
+	CriticalAdvisoriesBypassLimits bool
+
+	// criteria outdated pods in a namespace are restarted in order of, most important first. Pods
+	// that tie on every criterion keep the order they're listed in.
+	RestartOrder []string
+
+	// how long every namespace in a wave has to have been settled, with nothing left to restart
+	// and nothing rolling out, before namespaces in later waves are restarted
+	WaveBakeTime time.Duration
+
+	// reconcile every namespace with the istio label this often, to catch anything the watches
+	// missed. Zero disables this.
+	ResyncPeriod time.Duration
+
+	// name of the ConfigMap, in fortsa's namespace, where restart history and in-progress
+	// restarts are kept, so they survive restarts and leader changes. Empty disables this.
+	StateConfigMap string
+
+	// namespace fortsa runs in. Defaults to the namespace of its service account.
+	Namespace string
+
+	// additional kinds of pod controllers to restart. Entries here take precedence over
+	// fortsa's built-in handling of the same kind.
+	WorkloadKinds []WorkloadKind
 }
 
+// where to look for the config file, unless FORTSA_CONFIGFILE is set
+const defaultConfigDir = "/etc/fortsa"
+
 func GetConfig() (FortsaConfig, error) {
 
 	viper.SetDefault("DryRun", false)
 	viper.SetDefault("RestartsPerMinute", 5.0)
 	viper.SetDefault("ActiveRestartLimit", 5)
+	viper.SetDefault("OnDeletePodRestart", false)
+	viper.SetDefault("RestartStrategy", RestartStrategyRollout)
+	viper.SetDefault("MaxConcurrentEvictions", 5)
+	viper.SetDefault("MaxConcurrentReconciles", 1)
+	viper.SetDefault("PrioritizeOrphanedProxies", false)
+	viper.SetDefault("AllowDowngrades", false)
+	viper.SetDefault("MinorUpgradePolicy", UpgradePolicyRestart)
+	viper.SetDefault("PatchUpgradePolicy", UpgradePolicyRestart)
+	viper.SetDefault("MaxProxySkew", 2)
+	viper.SetDefault("AdvisoryFile", "")
+	viper.SetDefault("CriticalAdvisoriesBypassLimits", false)
+	viper.SetDefault("RestartOrder", []string{RestartOrderOrphaned, RestartOrderAdvisory, RestartOrderSkew,
+		RestartOrderPriority, RestartOrderPriorityClass, RestartOrderGatewaysLast})
+	viper.SetDefault("WaveBakeTime", "5m")
+	viper.SetDefault("ResyncPeriod", "10m")
+	viper.SetDefault("StateConfigMap", "istio-fortsa-state")
+	viper.SetDefault("Namespace", "")
 
 	viper.SetEnvPrefix("FORTSA")
 	viper.AutomaticEnv()
 
 	var cfg FortsaConfig
-	err := viper.Unmarshal(&cfg)
+
+	// settings that can't be expressed as environment variables go in an optional config file
+	viper.SetConfigName("fortsa")
+	viper.SetConfigType("yaml")
+	viper.AddConfigPath(defaultConfigDir)
+	if configFile := os.Getenv("FORTSA_CONFIGFILE"); configFile != "" {
+		viper.SetConfigFile(configFile)
+	}
+	err := viper.ReadInConfig()
+	if err != nil && !errors.As(err, &viper.ConfigFileNotFoundError{}) {
+		return cfg, err
+	}
+
+	err = viper.Unmarshal(&cfg)
 	if err != nil {
 		return cfg, err
 	}
 
+	if cfg.Namespace == "" {
+		cfg.Namespace = serviceAccountNamespace()
+	}
+
+	if !IsValidRestartStrategy(cfg.RestartStrategy) {
+		return cfg, fmt.Errorf("invalid RestartStrategy %q", cfg.RestartStrategy)
+	}
+	if !IsValidUpgradePolicy(cfg.MinorUpgradePolicy) {
+		return cfg, fmt.Errorf("invalid MinorUpgradePolicy %q", cfg.MinorUpgradePolicy)
+	}
+	if !IsValidUpgradePolicy(cfg.PatchUpgradePolicy) {
+		return cfg, fmt.Errorf("invalid PatchUpgradePolicy %q", cfg.PatchUpgradePolicy)
+	}
+	for _, criterion := range cfg.RestartOrder {
+		if !IsValidRestartCriterion(criterion) {
+			return cfg, fmt.Errorf("invalid RestartOrder criterion %q", criterion)
+		}
+	}
+
 	if cfg.DryRun {
 		fmt.Println("DRY RUN MODE ACTIVE")
 	}
 	fmt.Printf("RestartsPerMinute: %v\n", cfg.RestartsPerMinute)
 	fmt.Printf("ActiveRestartLimit: %v\n", cfg.ActiveRestartLimit)
+	fmt.Printf("OnDeletePodRestart: %v\n", cfg.OnDeletePodRestart)
+	fmt.Printf("RestartStrategy: %v\n", cfg.RestartStrategy)
+	fmt.Printf("MaxConcurrentEvictions: %v\n", cfg.MaxConcurrentEvictions)
+	fmt.Printf("MaxConcurrentReconciles: %v\n", cfg.MaxConcurrentReconciles)
+	fmt.Printf("PrioritizeOrphanedProxies: %v\n", cfg.PrioritizeOrphanedProxies)
+	fmt.Printf("AllowDowngrades: %v\n", cfg.AllowDowngrades)
+	fmt.Printf("MinorUpgradePolicy: %v\n", cfg.MinorUpgradePolicy)
+	fmt.Printf("PatchUpgradePolicy: %v\n", cfg.PatchUpgradePolicy)
+	fmt.Printf("MaxProxySkew: %v\n", cfg.MaxProxySkew)
+	fmt.Printf("AdvisoryFile: %v\n", cfg.AdvisoryFile)
+	fmt.Printf("CriticalAdvisoriesBypassLimits: %v\n", cfg.CriticalAdvisoriesBypassLimits)
+	fmt.Printf("RestartOrder: %v\n", strings.Join(cfg.RestartOrder, ","))
+	fmt.Printf("WaveBakeTime: %v\n", cfg.WaveBakeTime)
+	fmt.Printf("ResyncPeriod: %v\n", cfg.ResyncPeriod)
+	fmt.Printf("StateConfigMap: %v\n", cfg.StateConfigMap)
+	fmt.Printf("Namespace: %v\n", cfg.Namespace)
+	for _, wk := range cfg.WorkloadKinds {
+		fmt.Printf("WorkloadKind: %v/%v, Kind=%v\n", wk.Group, wk.Version, wk.Kind)
+	}
 
 	return cfg, nil
 }
+
+// where the namespace of the pod's service account is mounted
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// serviceAccountNamespace returns the namespace fortsa is running in, or "" when it's running
+// outside the cluster
+func serviceAccountNamespace() string {
+	data, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// IsValidRestartStrategy returns true if the given string names a known restart strategy
+func IsValidRestartStrategy(strategy string) bool {
+	switch strategy {
+	case RestartStrategyRollout, RestartStrategyEvict:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidUpgradePolicy returns true if the given string names a known upgrade policy
+func IsValidUpgradePolicy(policy string) bool {
+	switch policy {
+	case UpgradePolicyRestart, UpgradePolicySkip:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidRestartCriterion returns true if the given string names a known restart order criterion
+func IsValidRestartCriterion(criterion string) bool {
+	switch criterion {
+	case RestartOrderOrphaned, RestartOrderAdvisory, RestartOrderSkew,
+		RestartOrderPriority, RestartOrderPriorityClass, RestartOrderGatewaysLast:
+		return true
+	default:
+		return false
+	}
+}
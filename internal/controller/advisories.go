@@ -0,0 +1,95 @@
+package controller
+
+// Sidecars of istio versions listed in the advisory file have known vulnerabilities. They're
+// reported, and their pods are restarted ahead of all others, the most severe first.
+
+import (
+	"context"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/hercynium/istio-fortsa/internal/advisory"
+	"github.com/hercynium/istio-fortsa/internal/metrics"
+	"github.com/hercynium/istio-fortsa/internal/version"
+)
+
+// status board section listing vulnerable proxies
+const vulnerableSection = "vulnerableProxies"
+
+// VulnerableProxies lists the pods in a namespace whose sidecars are affected by an advisory
+type VulnerableProxies struct {
+	Advisory     string            `json:"advisory"`
+	Severity     advisory.Severity `json:"severity"`
+	ProxyVersion string            `json:"proxyVersion"`
+	Pods         []string          `json:"pods"`
+}
+
+// analyzeAdvisories matches the version of each pod's sidecar against the advisory file, reports
+// the pods affected, and returns the rank of the most severe advisory affecting each of them
+func (r *NamespaceReconciler) analyzeAdvisories(ctx context.Context, ns *corev1.Namespace, pods []metav1.PartialObjectMetadata,
+	versions map[string]version.Version) map[types.UID]int {
+	var log = log.FromContext(ctx)
+
+	var vulnerable = make(map[types.UID]int)
+	r.clearVulnerableProxies(ns.Name)
+	if r.advisories == nil {
+		return vulnerable
+	}
+	set, err := r.advisories.Current()
+	if err != nil {
+		// carry on with the advisories read last
+		log.Error(err, "Failed to read advisory file", "file", r.Config.AdvisoryFile)
+	}
+
+	var found = make(map[string]*VulnerableProxies)
+	for _, pod := range pods {
+		// the image the sidecar is running is what's vulnerable, whatever its revision is called
+		proxy, ok := r.proxyVersion(ctx, pod, versions)
+		if !ok {
+			continue
+		}
+		for _, adv := range set.Match(proxy) {
+			vulnerable[pod.UID] = max(vulnerable[pod.UID], adv.Severity.Rank())
+			var key = adv.ID + "/" + proxy.String()
+			if found[key] == nil {
+				found[key] = &VulnerableProxies{Advisory: adv.ID, Severity: adv.Severity, ProxyVersion: proxy.String()}
+			}
+			found[key].Pods = append(found[key].Pods, pod.Name)
+		}
+	}
+	if len(found) == 0 {
+		return vulnerable
+	}
+
+	var report = make([]VulnerableProxies, 0, len(found))
+	for _, v := range found {
+		sort.Strings(v.Pods)
+		report = append(report, *v)
+		metrics.VulnerableProxies.WithLabelValues(ns.Name, v.Advisory, string(v.Severity), v.ProxyVersion).Set(float64(len(v.Pods)))
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Severity.Rank() != report[j].Severity.Rank() {
+			return report[i].Severity.Rank() > report[j].Severity.Rank()
+		}
+		return report[i].Advisory+report[i].ProxyVersion < report[j].Advisory+report[j].ProxyVersion
+	})
+	r.Status.Set(vulnerableSection, ns.Name, report)
+	log.Info("Pods are running sidecars with known vulnerabilities", "ns", ns.Name, "pods", len(vulnerable))
+	return vulnerable
+}
+
+// clearVulnerableProxies removes any report of vulnerable proxies in the namespace
+func (r *NamespaceReconciler) clearVulnerableProxies(nsName string) {
+	r.Status.Delete(vulnerableSection, nsName)
+	metrics.VulnerableProxies.DeletePartialMatch(map[string]string{"namespace": nsName})
+}
+
+// bypassesLimits returns true if the pod's sidecar is too vulnerable for its restart to wait on
+// the restart limits
+func (r *NamespaceReconciler) bypassesLimits(pod metav1.PartialObjectMetadata, run *namespaceRun) bool {
+	return r.Config.CriticalAdvisoriesBypassLimits && run.vulnerable[pod.UID] >= advisory.SeverityCritical.Rank()
+}
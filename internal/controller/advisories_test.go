@@ -0,0 +1,81 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/hercynium/istio-fortsa/internal/advisory"
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/status"
+)
+
+var _ = Describe("Advisories", func() {
+	It("should match advisories against the proxy image the sidecar is running", func() {
+		var path = filepath.Join(GinkgoT().TempDir(), "advisories.yaml")
+		Expect(os.WriteFile(path, []byte(`
+advisories:
+  - id: ISTIO-SECURITY-2025-001
+    severity: critical
+    ranges:
+      - introduced: "1.23.0"
+        fixed: "1.23.3"
+`), 0o644)).To(Succeed())
+		advisories, err := advisory.NewFile(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		newPod := func(name, rev, image string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "ns", Name: name, UID: types.UID(name + "-uid"),
+					Annotations: map[string]string{common.IstioRevLabel: rev},
+				},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: istioProxyContainer, Image: image}}},
+			}
+		}
+		// the revision names say the opposite of what the images are
+		vulnerable := newPod("vulnerable", "1-23-3", "docker.io/istio/proxyv2:1.23.1")
+		patched := newPod("patched", "1-23-1", "docker.io/istio/proxyv2:1.23.3")
+		reader := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(vulnerable, patched).Build()
+		r := &NamespaceReconciler{
+			Status:         status.NewBoard(),
+			apiReader:      reader,
+			podDetailCache: make(map[string]map[types.UID]podDetail),
+			advisories:     advisories,
+		}
+		var pods []metav1.PartialObjectMetadata
+		for _, pod := range []*corev1.Pod{vulnerable, patched} {
+			pods = append(pods, metav1.PartialObjectMetadata{ObjectMeta: pod.ObjectMeta})
+		}
+
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}}
+		found := r.analyzeAdvisories(context.Background(), ns, pods, nil)
+		Expect(found).To(Equal(map[types.UID]int{vulnerable.UID: advisory.SeverityCritical.Rank()}))
+		r.clearVulnerableProxies("ns")
+	})
+})
@@ -0,0 +1,64 @@
+package controller
+
+// Pods without a controller have nothing to recreate them, so their outdated sidecars are only
+// reported, unless the namespace has opted in to having them deleted.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/metrics"
+)
+
+// allowsBarePodDeletion returns true if the namespace has opted in to having its outdated bare pods deleted
+func allowsBarePodDeletion(ns *corev1.Namespace) bool {
+	return ns.Annotations[common.BarePodDeletionAnnotation] == "true"
+}
+
+// reportBarePods reports the outdated pods in a namespace that have no controller and won't be
+// deleted, with an Event and a metric, or clears the report if there are none
+func (r *NamespaceReconciler) reportBarePods(ctx context.Context, ns *corev1.Namespace,
+	pods []metav1.PartialObjectMetadata, desiredRev string) {
+	var log = log.FromContext(ctx)
+
+	r.clearBarePods(ns.Name)
+	if allowsBarePodDeletion(ns) {
+		return
+	}
+
+	var podNames []string
+	for _, pod := range pods {
+		if isOutdatedPod(pod, desiredRev) && metav1.GetControllerOf(&pod) == nil {
+			podNames = append(podNames, pod.Name)
+		}
+	}
+	if len(podNames) == 0 {
+		return
+	}
+
+	sort.Strings(podNames)
+	log.Info("Outdated pods have no controller to recreate them and must be restarted manually",
+		"ns", ns.Name, "pods", len(podNames), "annotation", common.BarePodDeletionAnnotation)
+	metrics.OutdatedBarePods.WithLabelValues(ns.Name).Set(float64(len(podNames)))
+
+	var listed = podNames
+	if len(listed) > maxPodsInEvent {
+		listed = listed[:maxPodsInEvent]
+	}
+	r.Recorder.Event(ns, corev1.EventTypeWarning, "OutdatedBarePods", fmt.Sprintf(
+		"%d outdated pods have no controller to recreate them, so they must be restarted manually, "+
+			"or the namespace annotated with %v=true to have them deleted: %v",
+		len(podNames), common.BarePodDeletionAnnotation, strings.Join(listed, ", ")))
+}
+
+// clearBarePods removes any report of outdated bare pods in the namespace
+func (r *NamespaceReconciler) clearBarePods(nsName string) {
+	metrics.OutdatedBarePods.DeletePartialMatch(map[string]string{"namespace": nsName})
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/metrics"
+)
+
+var _ = Describe("Bare pods", func() {
+	var ctx = context.Background()
+	var isController = true
+
+	newPod := func(name, rev string, controlled bool) metav1.PartialObjectMetadata {
+		pod := metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "bare", Name: name, Annotations: map[string]string{common.IstioRevLabel: rev},
+		}}
+		if controlled {
+			pod.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web", UID: "rs-uid", Controller: &isController,
+			}}
+		}
+		return pod
+	}
+
+	var pods = []metav1.PartialObjectMetadata{
+		newPod("bare-old", "old", false),
+		newPod("bare-new", "new", false),
+		newPod("web-old", "old", true),
+	}
+
+	AfterEach(func() {
+		metrics.OutdatedBarePods.Reset()
+	})
+
+	It("should report outdated bare pods when the namespace doesn't allow deleting them", func() {
+		recorder := record.NewFakeRecorder(10)
+		r := &NamespaceReconciler{Recorder: recorder}
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "bare"}}
+
+		r.reportBarePods(ctx, ns, pods, "new")
+		Expect(testutil.ToFloat64(metrics.OutdatedBarePods.WithLabelValues("bare"))).To(Equal(1.0))
+		Expect(recorder.Events).To(Receive(And(ContainSubstring("OutdatedBarePods"), ContainSubstring("bare-old"))))
+
+		// once they're gone, so is the report
+		r.reportBarePods(ctx, ns, pods[1:], "new")
+		Expect(testutil.CollectAndCount(metrics.OutdatedBarePods)).To(BeZero())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("should not report bare pods the namespace allows deleting", func() {
+		recorder := record.NewFakeRecorder(10)
+		r := &NamespaceReconciler{Recorder: recorder}
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name: "bare", Annotations: map[string]string{common.BarePodDeletionAnnotation: "true"},
+		}}
+		Expect(allowsBarePodDeletion(ns)).To(BeTrue())
+
+		r.reportBarePods(ctx, ns, pods, "new")
+		Expect(testutil.CollectAndCount(metrics.OutdatedBarePods)).To(BeZero())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+})
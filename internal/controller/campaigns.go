@@ -0,0 +1,151 @@
+package controller
+
+// Campaigns start when an istio tag's webhook moves to another revision. Reconciles of the
+// namespaces using the tag report the state of their outdated workloads to the campaign, which is
+// published on the status board, as metrics and with Events on the tag's webhook configuration.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/governor"
+	"github.com/hercynium/istio-fortsa/internal/k8s"
+	"github.com/hercynium/istio-fortsa/internal/metrics"
+)
+
+// status board section listing campaigns
+const campaignsSection = "campaigns"
+
+// startCampaign starts a campaign if the webhook update moved an istio tag to another revision
+func (r *NamespaceReconciler) startCampaign(ctx context.Context, old, new *admissionregistrationv1.MutatingWebhookConfiguration,
+	nsRecs []reconcile.Request) {
+	var log = log.FromContext(ctx)
+
+	var tag = new.Labels[common.IstioTagLabel]
+	var sourceRev, targetRev = old.Labels[common.IstioRevLabel], new.Labels[common.IstioRevLabel]
+	if tag == "" || old.Labels[common.IstioTagLabel] != tag || sourceRev == "" || targetRev == "" || sourceRev == targetRev {
+		return
+	}
+
+	var namespaces = make([]string, 0, len(nsRecs))
+	for _, nsRec := range nsRecs {
+		namespaces = append(namespaces, nsRec.Name)
+		// later waves wait until these namespaces have moved and baked again
+		r.waves.Unsettle(nsRec.Name)
+	}
+	campaign, superseded := r.campaigns.Start(tag, sourceRev, targetRev, new.Name, namespaces)
+	if superseded != nil {
+		log.Info("Istio tag moved again, superseding its campaign", "campaign", superseded.ID, "istioTag", tag)
+		r.Recorder.Event(new, corev1.EventTypeNormal, "CampaignSuperseded", fmt.Sprintf(
+			"Campaign %v moving istio tag %v to revision %v was superseded by campaign %v",
+			superseded.ID, tag, superseded.TargetRev, campaign.ID))
+	}
+	log.Info("Istio tag moved, starting campaign", "campaign", campaign.ID, "istioTag", tag,
+		"sourceRev", sourceRev, "targetRev", targetRev, "namespaces", len(namespaces))
+	r.Recorder.Event(new, corev1.EventTypeNormal, "CampaignStarted", fmt.Sprintf(
+		"Campaign %v started moving %d namespaces using istio tag %v from revision %v to %v",
+		campaign.ID, len(namespaces), tag, sourceRev, targetRev))
+	if campaign.Ended != nil {
+		// no namespaces use the tag
+		r.campaignEnded(ctx, campaign)
+	}
+	r.publishCampaigns()
+}
+
+// observeCampaign reports the state of the namespace's outdated workloads to the campaign under
+// way for its istio tag, if there is one
+func (r *NamespaceReconciler) observeCampaign(ctx context.Context, ns *corev1.Namespace, desiredRev string,
+	finder *k8s.ControllerFinder, pods []metav1.PartialObjectMetadata, failed map[governor.ControllerKey]bool) {
+	var campaign, ok = r.campaigns.ActiveFor(ns.Labels[common.IstioRevLabel])
+	if !ok || campaign.TargetRev != desiredRev {
+		return
+	}
+
+	var outdated = make(map[governor.ControllerKey]governor.WorkloadState)
+	for _, pod := range pods {
+		if !isOutdatedPod(pod, desiredRev) {
+			continue
+		}
+		owner, err := finder.FindPodControllerMetadata(ctx, pod)
+		if err != nil {
+			// the pod or its controller is probably being deleted
+			continue
+		}
+		var key = governor.KeyOf(owner)
+		var _, active = r.governor.Active(key)
+		switch {
+		case failed[key]:
+			outdated[key] = governor.WorkloadFailed
+		case active:
+			outdated[key] = governor.WorkloadInProgress
+		case r.ledger.RestartedFor(key, desiredRev):
+			// restarted and rolled out, but still outdated
+			outdated[key] = governor.WorkloadFailed
+		default:
+			outdated[key] = governor.WorkloadPending
+		}
+	}
+
+	if campaign, ended := r.campaigns.Observe(campaign.ID, ns.Name, outdated); ended {
+		r.campaignEnded(ctx, campaign)
+	}
+	r.publishCampaigns()
+}
+
+// campaignEnded reports a campaign that has completed
+func (r *NamespaceReconciler) campaignEnded(ctx context.Context, campaign governor.Campaign) {
+	var log = log.FromContext(ctx)
+
+	log.Info("Campaign completed", "campaign", campaign.ID, "istioTag", campaign.Tag,
+		"done", campaign.Done, "failed", campaign.Failed,
+		"duration", campaign.Ended.Sub(campaign.Started).Round(time.Second))
+
+	var webhook = &admissionregistrationv1.MutatingWebhookConfiguration{}
+	if err := r.Get(ctx, client.ObjectKey{Name: campaign.Webhook}, webhook); err != nil {
+		log.Info("Couldn't get webhook to record campaign's completion on", "webhookName", campaign.Webhook, "err", err)
+		return
+	}
+	var eventType = corev1.EventTypeNormal
+	if campaign.Failed > 0 {
+		eventType = corev1.EventTypeWarning
+	}
+	r.Recorder.Event(webhook, eventType, "CampaignCompleted", fmt.Sprintf(
+		"Campaign %v moving istio tag %v to revision %v completed: %d workloads restarted, %d still outdated",
+		campaign.ID, campaign.Tag, campaign.TargetRev, campaign.Done, campaign.Failed))
+}
+
+// publishCampaigns puts the campaigns on the status board and in the metrics
+func (r *NamespaceReconciler) publishCampaigns() {
+	r.campaignsMu.Lock()
+	defer r.campaignsMu.Unlock()
+
+	var campaigns = r.campaigns.List()
+	var findings = make(map[string]any, len(campaigns))
+	metrics.CampaignWorkloads.Reset()
+	metrics.CampaignETA.Reset()
+	for _, campaign := range campaigns {
+		findings[campaign.ID] = campaign
+		for state, count := range map[governor.WorkloadState]int{
+			governor.WorkloadPending:    campaign.Pending,
+			governor.WorkloadInProgress: campaign.InProgress,
+			governor.WorkloadDone:       campaign.Done,
+			governor.WorkloadFailed:     campaign.Failed,
+		} {
+			metrics.CampaignWorkloads.WithLabelValues(campaign.ID, campaign.Tag, campaign.SourceRev, campaign.TargetRev,
+				string(state)).Set(float64(count))
+		}
+		if campaign.ETA != nil {
+			metrics.CampaignETA.WithLabelValues(campaign.ID).Set(float64(campaign.ETA.Unix()))
+		}
+	}
+	r.Status.Replace(campaignsSection, findings)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/governor"
+	"github.com/hercynium/istio-fortsa/internal/status"
+)
+
+var _ = Describe("Campaigns", func() {
+	var ctx = context.Background()
+
+	It("should complete a campaign right away when no namespaces use the tag", func() {
+		tagWebhook := func(rev string) *admissionregistrationv1.MutatingWebhookConfiguration {
+			return &admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{
+				Name: "istio-revision-tag-unused",
+				Labels: map[string]string{
+					"app": webhookAppLabelValue, common.IstioTagLabel: "unused", common.IstioRevLabel: rev,
+				},
+			}}
+		}
+		oldWebhook, newWebhook := tagWebhook("1-22-0"), tagWebhook("1-23-0")
+		recorder := record.NewFakeRecorder(10)
+		r := &NamespaceReconciler{
+			Client:    fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(newWebhook).Build(),
+			Recorder:  recorder,
+			Status:    status.NewBoard(),
+			campaigns: governor.NewCampaigns(5),
+			waves:     governor.NewWaves(),
+		}
+
+		r.startCampaign(ctx, oldWebhook, newWebhook, nil)
+		Expect(recorder.Events).To(Receive(ContainSubstring("CampaignStarted")))
+		Expect(recorder.Events).To(Receive(ContainSubstring("CampaignCompleted")))
+		Expect(r.campaigns.List()).To(ConsistOf(HaveField("Outcome", governor.CampaignCompleted)))
+		_, ok := r.campaigns.ActiveFor("unused")
+		Expect(ok).To(BeFalse())
+	})
+})
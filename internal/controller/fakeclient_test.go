@@ -0,0 +1,70 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/hercynium/istio-fortsa/internal/config"
+	"github.com/hercynium/istio-fortsa/internal/governor"
+	"github.com/hercynium/istio-fortsa/internal/k8s"
+	"github.com/hercynium/istio-fortsa/internal/status"
+)
+
+// fakeIndexer registers field indexes on a fake client builder
+type fakeIndexer struct {
+	builder *fake.ClientBuilder
+}
+
+func (i fakeIndexer) IndexField(ctx context.Context, obj client.Object, field string, extract client.IndexerFunc) error {
+	i.builder.WithIndex(obj, field, extract)
+	return nil
+}
+
+// newFakeClientBuilder returns a fake client builder with the same field indexes as the manager's cache
+func newFakeClientBuilder() *fake.ClientBuilder {
+	var builder = fake.NewClientBuilder().WithScheme(scheme.Scheme)
+	Expect(k8s.IndexPods(context.Background(), fakeIndexer{builder: builder})).To(Succeed())
+	return builder
+}
+
+// newFakeReconciler returns a namespace reconciler working with the given client, with the default
+// restart limits and nothing restarted yet
+func newFakeReconciler(c client.Client, recorder record.EventRecorder) *NamespaceReconciler {
+	return &NamespaceReconciler{
+		Client:         c,
+		Config:         config.FortsaConfig{ActiveRestartLimit: 5, MaxConcurrentEvictions: 5},
+		Recorder:       recorder,
+		Status:         status.NewBoard(),
+		evictor:        k8s.NewEvictor(c, 5),
+		restarters:     k8s.DefaultRestarters.Clone(),
+		governor:       governor.New(0, 5),
+		ledger:         governor.NewLedger(),
+		apiReader:      c,
+		podDetailCache: make(map[string]map[types.UID]podDetail),
+		campaigns:      governor.NewCampaigns(0),
+		waves:          governor.NewWaves(),
+	}
+}
@@ -18,17 +18,22 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
-	"golang.org/x/time/rate"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -41,20 +46,46 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	"github.com/hercynium/istio-fortsa/internal/advisory"
 	"github.com/hercynium/istio-fortsa/internal/common"
 	"github.com/hercynium/istio-fortsa/internal/config"
+	"github.com/hercynium/istio-fortsa/internal/governor"
 	"github.com/hercynium/istio-fortsa/internal/k8s"
+	"github.com/hercynium/istio-fortsa/internal/status"
 )
 
 // NamespaceReconciler reconciles a Namespace object
 type NamespaceReconciler struct {
 	client.Client
-	Scheme     *runtime.Scheme
-	Config     config.FortsaConfig
-	KubeClient *kubernetes.Clientset
-}
+	Scheme   *runtime.Scheme
+	Config   config.FortsaConfig
+	Recorder record.EventRecorder
+
+	// findings about the cluster, served on the metrics endpoint
+	Status *status.Board
+
+	evictor    *k8s.Evictor
+	restarters *k8s.RestarterRegistry
+	governor   *governor.Governor
+	ledger     *governor.Ledger
+	store      *governor.Store
+
+	// reads straight from the API server, for what isn't cached
+	apiReader client.Reader
+
+	// what's been read from pods' specs, by namespace and pod UID
+	podDetailCache map[string]map[types.UID]podDetail
+	podDetailsMu   sync.Mutex
+
+	// known vulnerabilities of istio proxy versions, if there's an advisory file
+	advisories *advisory.File
 
-type controllerSet map[string]bool
+	campaigns   *governor.Campaigns
+	campaignsMu sync.Mutex
+
+	// namespaces in waves, and whether they've settled
+	waves *governor.Waves
+}
 
 // Allow read-only access to Namespaces
 // +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
@@ -71,6 +102,9 @@ type controllerSet map[string]bool
 //+kubebuilder:rbac:groups=core,resources=pods/status,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=pods/finalizers,verbs=get;list;watch
 
+// Allow recording Events about namespaces
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
 // Allow read-only access to everything
 // +kubebuilder:rbac:groups=*,resources=*,verbs=get;list;watch
 
@@ -89,118 +123,533 @@ func (r *NamespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	// name of this namespace
 	var nsName = req.Name
 
+	// pick up where the last leader left off
+	if err := r.loadState(ctx); err != nil {
+		log.Error(err, "Failed to load saved restart state")
+		return ctrl.Result{}, err
+	}
+	defer r.saveState(ctx)
+
+	var ns = &corev1.Namespace{}
+	err := r.Get(ctx, client.ObjectKey{Name: nsName}, ns, &client.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// namespace was deleted, nothing to do
+		r.governor.FinishNamespace(nsName)
+		r.ledger.ForgetNamespace(nsName)
+		r.clearMisconfiguration(nsName)
+		r.clearOrphanedProxies(nsName)
+		r.clearBarePods(nsName)
+		r.clearSkew(nsName)
+		r.clearVulnerableProxies(nsName)
+		r.forgetPodDetails(nsName, nil)
+		r.clearWave(nsName)
+		for _, campaign := range r.campaigns.ForgetNamespace(nsName) {
+			r.campaignEnded(ctx, campaign)
+		}
+		r.publishCampaigns()
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		log.Error(err, "Failed to get namespace", "ns", nsName)
+		return ctrl.Result{}, err
+	}
+
+	// namespaces in later waves wait for this one to settle
+	var wave, inWave = namespaceWave(ctx, ns)
+
 	// istio rev pods in this namespace should use
-	var nsDesiredRev, err = r.getNamespaceDesiredRev(ctx, nsName)
+	nsDesiredRev, misconfig, err := r.resolveNamespaceRev(ctx, ns)
 	if err != nil {
 		log.Error(err, "Failed to get istio revision associated with this namespace", "ns", nsName)
 		return ctrl.Result{}, err
 	}
 
-	// get pods in the namespace
-	var pods = &corev1.PodList{}
-	err = r.List(ctx, pods, &client.ListOptions{
-		Namespace: nsName,
-	})
+	// get pods with istio sidecars in the namespace
+	pods, err := k8s.ListInjectedPods(ctx, r.Client, nsName)
 	if err != nil {
 		log.Error(err, "Failed to get list of pods in this namespace", "ns", nsName)
 		return ctrl.Result{}, err
 	}
+	defer r.forgetPodDetails(nsName, pods)
+
+	// revisions whose control plane is still around
+	knownRevs, err := r.knownRevisions(ctx)
+	if err != nil {
+		log.Error(err, "Failed to get installed istio revisions")
+		return ctrl.Result{}, err
+	}
+	r.reportOrphanedProxies(ctx, ns, pods, knownRevs)
+
+	// sidecars too far from their control plane's version are restarted first
+	versions, err := r.revisionVersions(ctx)
+	if err != nil {
+		log.Error(err, "Failed to get istio versions of installed revisions")
+		return ctrl.Result{}, err
+	}
+	var finder = k8s.NewControllerFinder(r.Client, r.RESTMapper())
+	var skew = r.analyzeSkew(ctx, ns, pods, versions, finder)
+	var vulnerable = r.analyzeAdvisories(ctx, ns, pods, versions)
+
+	// restarting pods now would bring them back without a sidecar
+	if misconfig != nil {
+		r.governor.SetPriorityPending(nsName, false)
+		r.recordWave(ns, wave, inWave, nsDesiredRev, true, nil, nil)
+		r.reportMisconfiguration(ctx, ns, misconfig)
+		return ctrl.Result{}, nil
+	}
+	r.clearMisconfiguration(nsName)
+	r.reportBarePods(ctx, ns, pods, nsDesiredRev)
+
+	// work planned for an earlier target is stale, so it's dropped and planned again
+	if previousRev, changed := r.ledger.Retarget(nsName, nsDesiredRev); changed {
+		r.waves.Unsettle(nsName)
+		r.supersedeRestarts(ctx, ns, previousRev, nsDesiredRev)
+	}
+
+	// leave alone the pods the version policy doesn't allow restarting
+	var restartable, blocked = r.applyVersionPolicy(ctx, ns, pods, nsDesiredRev, versions, finder)
+
+	var run = &namespaceRun{
+		ns:         ns,
+		desiredRev: nsDesiredRev,
+		knownRevs:  knownRevs,
+		skew:       skew,
+		vulnerable: vulnerable,
+		strategy:   r.restartStrategy(ctx, ns),
+		finder:     finder,
+		failed:     blocked,
+	}
+
+	// restart the most important pods first
+	r.planRestarts(ctx, restartable, run)
+
+	// and none until earlier waves have settled and baked, unless they can't wait
+	var waitingOn []string
+	var waveWait time.Duration
+	if inWave && hasOutdatedPods(restartable, nsDesiredRev) {
+		waitingOn, waveWait, err = r.waveBlockers(ctx, wave)
+		if err != nil {
+			log.Error(err, "Failed to check on earlier waves", "ns", nsName, "wave", wave)
+			return ctrl.Result{}, err
+		}
+		if len(waitingOn) > 0 {
+			log.Info("Waiting on namespaces in earlier waves before restarting outdated pods",
+				"ns", nsName, "wave", wave, "waitingOn", waitingOn, "retryAfter", waveWait)
+			restartable = r.holdForWave(restartable, run)
+		}
+	}
 
 	// check each pod if it's using the desired revision of Istio
-	var seenControllers = make(controllerSet)
-	for _, pod := range pods.Items {
-		var podIstioRev = pod.Annotations[common.IstioRevLabel]
-		if podIstioRev != "" && podIstioRev != nsDesiredRev {
+	run.session = r.governor.NewSession()
+	defer run.session.Release()
+	var requeue = false
+	var priorityPending = false
+	for _, pod := range restartable {
+		if isOutdatedPod(pod, nsDesiredRev) {
+			var podIstioRev = pod.Annotations[common.IstioRevLabel]
 			log.Info("Outdated pod found", "ns", nsName, "nsRev", nsDesiredRev, "pod", pod.Name, "podRev", podIstioRev)
-			err := r.RestartPodController(ctx, req, pod, seenControllers)
+			inProgress, err := r.restartPodController(ctx, run, pod)
+			if errors.Is(err, errTargetChanged) {
+				log.Info("Namespace's istio revision changed while restarting, replanning", "ns", nsName, "nsRev", nsDesiredRev)
+				r.recordWave(ns, wave, inWave, nsDesiredRev, false, nil, nil)
+				return ctrl.Result{RequeueAfter: retargetRequeueInterval}, nil
+			}
 			if err != nil {
 				log.Error(err, "Couldn't restart controller for pod", "ns", pod.Namespace, "pod", pod.Name)
 			}
+			requeue = requeue || inProgress
+			if inProgress && r.isPriorityPod(pod, run) {
+				priorityPending = true
+			}
 		}
 	}
+	r.governor.SetPriorityPending(nsName, priorityPending)
 
+	// keep checking on restarts until they're done, so they stop counting against the limits
+	if r.finishRestarts(ctx, nsName, run.session) {
+		requeue = true
+	}
+	r.observeCampaign(ctx, ns, nsDesiredRev, run.finder, pods, run.failed)
+	// outdated pods still to be restarted keep later waves waiting, but ones that won't be don't
+	var stuck, pending = r.stuckPods(ctx, pods, run)
+	r.recordWave(ns, wave, inWave, nsDesiredRev, !requeue && len(waitingOn) == 0 && !pending, waitingOn, stuck)
+
+	// evictions blocked by PodDisruptionBudgets are tried again once their backoff is over
+	var requeueAfter = inProgressRequeueInterval
+	if retryAfter := r.evictor.RetryAfter(nsName); retryAfter > 0 {
+		requeueAfter = retryAfter
+	}
+	if len(waitingOn) > 0 && (!requeue || waveWait < requeueAfter) {
+		return ctrl.Result{RequeueAfter: waveWait}, nil
+	}
+	if requeue {
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
 	return ctrl.Result{}, nil
 }
 
-func (r *NamespaceReconciler) RestartPodController(ctx context.Context, req ctrl.Request, pod corev1.Pod, seenControllers controllerSet) error {
+// hasOutdatedPods returns true if any of the pods aren't using the desired revision
+func hasOutdatedPods(pods []metav1.PartialObjectMetadata, desiredRev string) bool {
+	for _, pod := range pods {
+		if isOutdatedPod(pod, desiredRev) {
+			return true
+		}
+	}
+	return false
+}
+
+// holdForWave leaves out the outdated pods that have to wait on earlier waves. Pods whose
+// sidecars are too vulnerable to wait on restart limits don't wait on waves either.
+func (r *NamespaceReconciler) holdForWave(pods []metav1.PartialObjectMetadata, run *namespaceRun) []metav1.PartialObjectMetadata {
+	var kept = make([]metav1.PartialObjectMetadata, 0, len(pods))
+	for _, pod := range pods {
+		if !isOutdatedPod(pod, run.desiredRev) || pod.DeletionTimestamp != nil || r.bypassesLimits(pod, run) {
+			kept = append(kept, pod)
+		}
+	}
+	return kept
+}
+
+// namespaceRun holds what one reconcile of a namespace works with
+type namespaceRun struct {
+	ns *corev1.Namespace
+
+	// istio revision pods in the namespace should use
+	desiredRev string
+
+	// istio revisions whose control plane is still around
+	knownRevs map[string]bool
+
+	// how many minor versions pods' sidecars are out of the supported skew, by pod UID
+	skew map[types.UID]int
+
+	// rank of the most severe advisory affecting pods' sidecars, by pod UID
+	vulnerable map[types.UID]int
+
+	// how outdated pods are restarted, one of the config.RestartStrategy values
+	strategy string
+
+	finder  *k8s.ControllerFinder
+	session *governor.Session
+
+	// controllers that couldn't be restarted, or that the version policy doesn't allow restarting
+	failed map[governor.ControllerKey]bool
+}
+
+// isPriorityPod returns true if restarting the pod should go ahead of other restarts
+func (r *NamespaceReconciler) isPriorityPod(pod metav1.PartialObjectMetadata, run *namespaceRun) bool {
+	return (r.Config.PrioritizeOrphanedProxies && isOrphanedPod(pod, run.knownRevs)) ||
+		run.skew[pod.UID] > 0 || run.vulnerable[pod.UID] > 0
+}
+
+// how long to wait before checking on restarts that take more than one step
+const inProgressRequeueInterval = 30 * time.Second
+
+// how long to wait before replanning restarts after the namespace's revision changed
+const retargetRequeueInterval = time.Second
+
+// errTargetChanged means the namespace's istio revision changed since the reconcile started
+var errTargetChanged = errors.New("namespace's istio revision changed")
+
+// loadState loads the restart state saved in the cluster, the first time it's called
+func (r *NamespaceReconciler) loadState(ctx context.Context) error {
+	if r.store == nil {
+		return nil
+	}
+	return r.store.Load(ctx, r.governor, r.ledger)
+}
+
+// saveState saves the restart state in the cluster, if it has changed
+func (r *NamespaceReconciler) saveState(ctx context.Context) {
+	if r.store == nil || r.Config.DryRun {
+		return
+	}
+	if err := r.store.Save(ctx, r.governor, r.ledger); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to save restart state", "configMap", r.Config.StateConfigMap)
+	}
+}
+
+// restartStrategy returns the strategy to use for restarting outdated pods in the namespace
+func (r *NamespaceReconciler) restartStrategy(ctx context.Context, ns *corev1.Namespace) string {
+	var log = log.FromContext(ctx)
+
+	var strategy, ok = ns.Annotations[common.RestartStrategyAnnotation]
+	if !ok {
+		return r.Config.RestartStrategy
+	}
+	if !config.IsValidRestartStrategy(strategy) {
+		log.Info("Ignoring invalid restart strategy annotation on namespace",
+			"ns", ns.Name, "annotation", common.RestartStrategyAnnotation, "value", strategy)
+		return r.Config.RestartStrategy
+	}
+	return strategy
+}
+
+// a pod is outdated if it has an istio sidecar from a revision other than the desired one
+func isOutdatedPod(pod metav1.PartialObjectMetadata, desiredRev string) bool {
+	var podIstioRev = pod.Annotations[common.IstioRevLabel]
+	return podIstioRev != "" && podIstioRev != desiredRev
+}
+
+// restartPodController restarts the controller of the given pod. It returns true if the restart
+// is being done in steps, or is waiting on the restart limits, and the namespace needs to be
+// reconciled again to continue it.
+func (r *NamespaceReconciler) restartPodController(ctx context.Context, run *namespaceRun,
+	pod metav1.PartialObjectMetadata) (bool, error) {
 	var log = log.FromContext(ctx)
+	var ns, desiredRev, session = run.ns, run.desiredRev, run.session
 
 	// find the controller of the pod
-	pc, err := k8s.FindPodController(ctx, *r.KubeClient, pod)
+	pc, err := run.finder.FindPodController(ctx, pod)
 	if err != nil {
 		log.Info("Could not find controller for pod", "err", err, "ns", pod.Namespace, "pod", pod.Name)
 		// not returning error, since it (pod or controller) probably was deleted
-		return nil
+		return false, nil
 	}
 
-	if seenControllers[pc.GetName()] {
+	var key = governor.KeyOf(pc)
+	if session.Holds(key) {
 		log.Info("Alredy seen the controller for this pod",
 			"ns", pod.Namespace, "pod", pod.Name,
 			"podController", pc.GetName(), "podControllerKind", pc.GetKind())
-		return nil
+		return false, nil
+	}
+	if !session.Claim(key) {
+		log.Info("Controller for this pod is being handled by another reconcile",
+			"ns", pod.Namespace, "pod", pod.Name,
+			"podController", pc.GetName(), "podControllerKind", pc.GetKind())
+		return true, nil
 	}
-	seenControllers[pc.GetName()] = true
 
 	// make sure the controller is one we can restart
-	switch pc.GetKind() {
-	case "DaemonSet", "Deployment", "StatefulSet":
-		break
-	default:
+	restarter, ok := r.restarters.Lookup(pc.GroupVersionKind())
+	if run.strategy == config.RestartStrategyEvict && pc.GetKind() != "Pod" {
+		// the evict strategy works the same for every kind, leaving the controller untouched
+		restarter, ok = k8s.EvictRestarter, true
+	}
+	if !ok {
 		log.Info("Upsupported controller type for restart",
 			"ns", pod.Namespace, "pod", pod.Name,
 			"podController", pc.GetName(), "podControllerKind", pc.GetKind())
-		return nil
+		run.failed[key] = true
+		return false, nil
+	}
+
+	restartReq := k8s.RestartRequest{
+		Client:               r.Client,
+		Evictor:              r.evictor,
+		Pod:                  pod,
+		IsOutdated:           func(p metav1.PartialObjectMetadata) bool { return isOutdatedPod(p, desiredRev) },
+		DryRun:               r.Config.DryRun,
+		MaxTerminating:       r.Config.MaxConcurrentEvictions,
+		OnDeletePodRestart:   r.Config.OnDeletePodRestart,
+		AllowBarePodDeletion: allowsBarePodDeletion(ns),
+	}
+
+	if canRestart, reason := restarter.CanRestart(ctx, pc, restartReq); !canRestart {
+		log.Info("Not restarting controller for pod: "+reason,
+			"ns", pod.Namespace, "pod", pod.Name,
+			"podController", pc.GetName(), "podControllerKind", pc.GetKind())
+		run.failed[key] = true
+		return false, nil
+	}
+
+	complete, err := restarter.IsRolloutComplete(ctx, pc)
+	if err != nil {
+		return true, err
+	}
+	if !complete {
+		log.Info("Controller is still rolling out, waiting for it to finish",
+			"ns", pod.Namespace, "pod", pod.Name,
+			"podController", pc.GetName(), "podControllerKind", pc.GetKind())
+		return true, nil
+	}
+
+	// the tag may have moved since the reconcile started, and restarts for the old target would be wasted
+	if rev, err := r.getNamespaceDesiredRev(ctx, ns); err != nil {
+		return true, err
+	} else if rev != desiredRev {
+		return true, errTargetChanged
+	}
+
+	// dry runs don't change anything, so they don't count against the limits
+	if !r.Config.DryRun {
+		// a restart we did earlier has rolled out
+		if active, ok := r.governor.Active(key); ok && !active.Stepwise {
+			r.governor.Finish(key)
+		}
+		if r.ledger.RestartedFor(key, desiredRev) {
+			entry, _ := r.ledger.Get(key)
+			log.Info("Controller was already restarted for this revision, but the pod is still outdated. "+
+				"It won't be restarted again until the namespace's revision changes.",
+				"ns", pod.Namespace, "pod", pod.Name,
+				"podController", pc.GetName(), "podControllerKind", pc.GetKind(),
+				"targetRev", entry.TargetRev, "restartedAt", entry.RestartedAt)
+			return false, nil
+		}
+		if r.bypassesLimits(pod, run) {
+			log.Info("Restarting controller without waiting on restart limits, since its sidecars have a critical vulnerability",
+				"ns", pod.Namespace, "pod", pod.Name,
+				"podController", pc.GetName(), "podControllerKind", pc.GetKind())
+			r.governor.ForceStart(key, pc.GroupVersionKind())
+		} else if started, retryAfter := r.governor.TryStart(key, pc.GroupVersionKind(), r.isPriorityPod(pod, run)); !started {
+			log.Info("Restart limits reached, waiting to restart controller",
+				"ns", pod.Namespace, "pod", pod.Name,
+				"podController", pc.GetName(), "podControllerKind", pc.GetKind(), "retryAfter", retryAfter)
+			return true, nil
+		}
 	}
 
 	// do the thing
-	dryRun := r.Config.DryRun
-	err = k8s.DoRolloutRestart(ctx, r.Client, pc, dryRun)
+	inProgress, err := restarter.Restart(ctx, pc, restartReq)
 	if err != nil {
+		r.governor.Finish(key)
+		run.failed[key] = true
 		log.Error(err, "Error doing rollout restart on controller for pod",
 			"ns", pod.Namespace, "pod", pod.Name,
 			"podController", pc.GetName(), "podControllerKind", pc.GetKind())
-		return err
+		return inProgress, err
+	}
+	if !r.Config.DryRun {
+		r.governor.SetStepwise(key, inProgress)
+		r.ledger.Record(key, desiredRev, inProgress)
 	}
 
-	return nil
+	return inProgress, nil
 }
 
-func (r *NamespaceReconciler) getNamespaceDesiredRev(ctx context.Context, nsName string) (string, error) {
-	var _ = log.FromContext(ctx)
+// finishRestarts checks on the active restarts in the namespace that this reconcile didn't come
+// across, and finishes those that are done. It returns true if any restarts are still active.
+func (r *NamespaceReconciler) finishRestarts(ctx context.Context, nsName string, session *governor.Session) bool {
+	var log = log.FromContext(ctx)
 
-	var ns = &corev1.Namespace{}
-	err := r.Get(ctx, client.ObjectKey{Name: nsName}, ns, &client.GetOptions{})
-	if err != nil {
-		return "", err
-	}
+	var stillActive = false
+	for key, restart := range r.governor.ActiveIn(nsName) {
+		if session.Holds(key) {
+			stillActive = true
+			continue
+		}
+		if restart.Stepwise {
+			// no outdated pods led us to the controller, so there are no more steps to take
+			r.governor.Finish(key)
+			r.ledger.FinishSteps(key)
+			continue
+		}
 
-	// istio revision or tag this namespace is configured to use
-	var nsIstioRevLabelValue = ns.Labels[common.IstioRevLabel]
+		var obj = &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(restart.GVK)
+		err := r.Get(ctx, key.NamespacedName, obj)
+		if apierrors.IsNotFound(err) {
+			r.governor.Finish(key)
+			r.ledger.Forget(key)
+			continue
+		}
+		if err != nil {
+			log.Error(err, "Failed to check on restarted controller", "ns", nsName, "podController", key.Name)
+			stillActive = true
+			continue
+		}
 
-	// get the webhooks that correspond to the label on the namespace
-	var webhooks = &admissionregistrationv1.MutatingWebhookConfigurationList{}
-	err = r.List(ctx, webhooks, &client.ListOptions{
-		LabelSelector: labels.Set{common.IstioTagLabel: nsIstioRevLabelValue}.AsSelector(),
-	})
-	if err != nil {
-		return "", err
+		restarter, ok := r.restarters.Lookup(restart.GVK)
+		if !ok {
+			r.governor.Finish(key)
+			continue
+		}
+		complete, err := restarter.IsRolloutComplete(ctx, obj)
+		if err != nil || !complete {
+			stillActive = true
+			continue
+		}
+		log.Info("Controller finished rolling out",
+			"ns", nsName, "podController", key.Name, "podControllerKind", key.Kind,
+			"duration", time.Since(restart.Started).Round(time.Second))
+		r.governor.Finish(key)
 	}
+	return stillActive
+}
 
-	// map webhook tags to istio revisions for easy lookup. { tag => rev }
-	var tagMap = make(map[string]string)
-	for _, webhook := range webhooks.Items {
-		tagMap[webhook.Labels[common.IstioTagLabel]] = webhook.Labels[common.IstioRevLabel]
-	}
+// supersedeRestarts cancels the namespace's restarts that are being done in steps, since the steps
+// left were planned for an earlier revision. Rollouts already under way are left to finish, since
+// their new pods get the current revision's sidecars anyway.
+func (r *NamespaceReconciler) supersedeRestarts(ctx context.Context, ns *corev1.Namespace, previousRev, desiredRev string) {
+	var log = log.FromContext(ctx)
 
-	// the revision that corresponds to the tag indicated by the label on the namespace
-	var nsDesiredRev = tagMap[ns.Labels[common.IstioRevLabel]]
+	var cancelled = 0
+	for key, restart := range r.governor.ActiveIn(ns.Name) {
+		if restart.Stepwise {
+			r.governor.Finish(key)
+			cancelled++
+		}
+	}
+	log.Info("Namespace's istio revision changed, replanning its restarts",
+		"ns", ns.Name, "previousRev", previousRev, "nsRev", desiredRev, "cancelled", cancelled)
+	r.Recorder.Event(ns, corev1.EventTypeNormal, "RestartsSuperseded", fmt.Sprintf(
+		"Istio revision changed from %v to %v, so restarts are planned again for %v (%d stepwise restarts cancelled)",
+		previousRev, desiredRev, desiredRev, cancelled))
+}
 
-	return nsDesiredRev, nil
+// getNamespaceDesiredRev returns the istio revision pods in the namespace should use, or "" if
+// the namespace is misconfigured
+func (r *NamespaceReconciler) getNamespaceDesiredRev(ctx context.Context, ns *corev1.Namespace) (string, error) {
+	rev, _, err := r.resolveNamespaceRev(ctx, ns)
+	return rev, err
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *NamespaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorderFor("fortsa")
+	}
+	if r.Status == nil {
+		r.Status = status.NewBoard()
+	}
+	if err := mgr.AddMetricsServerExtraHandler(status.Path, r.Status); err != nil {
+		return err
+	}
+
+	// the revision report only runs on the leader, since it emits Events
+	if err := mgr.Add(&RevisionReporter{
+		Client:   mgr.GetClient(),
+		Mapper:   mgr.GetRESTMapper(),
+		Recorder: r.Recorder,
+		Status:   r.Status,
+	}); err != nil {
+		return err
+	}
+
+	// pods are only read as metadata, and looked up by the revision of their sidecars
+	if err := k8s.IndexPods(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		return err
+	}
+
+	r.apiReader = mgr.GetAPIReader()
+	if r.Config.AdvisoryFile != "" {
+		advisories, err := advisory.NewFile(r.Config.AdvisoryFile)
+		if err != nil {
+			return err
+		}
+		r.advisories = advisories
+	}
+	r.podDetailCache = make(map[string]map[types.UID]podDetail)
+	r.evictor = k8s.NewEvictor(mgr.GetClient(), r.Config.MaxConcurrentEvictions)
+	r.governor = governor.New(r.Config.RestartsPerMinute, r.Config.ActiveRestartLimit)
+	r.ledger = governor.NewLedger()
+	r.campaigns = governor.NewCampaigns(r.Config.RestartsPerMinute)
+	r.waves = governor.NewWaves()
+	if r.Config.StateConfigMap != "" && r.Config.Namespace != "" {
+		r.store = governor.NewStore(mgr.GetAPIReader(), mgr.GetClient(), r.Config.Namespace, r.Config.StateConfigMap)
+	} else {
+		ctrl.Log.WithName("setup").Info("Restart state won't be saved in the cluster, " +
+			"since either StateConfigMap or Namespace isn't set")
+	}
+
+	// kinds described in the config file take precedence over the built-in ones
+	r.restarters = k8s.DefaultRestarters.Clone()
+	if err := k8s.RegisterWorkloadKinds(r.restarters, r.Config.WorkloadKinds); err != nil {
+		return err
+	}
+
 	// also watch changes to MutatingWebhookConfigurations, because changing the istio
 	// webhooks means we need to reconcile namespaces.
 	src := source.Kind(
@@ -210,16 +659,28 @@ func (r *NamespaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		onlyReconcileIstioWebhooks(),
 	)
 
-	return ctrl.NewControllerManagedBy(mgr).
+	// and watch pods, to catch outdated pods created after their namespace was reconciled
+	podSrc := source.Kind(
+		mgr.GetCache(),
+		k8s.NewPodMetadata(),
+		handler.TypedEnqueueRequestsFromMapFunc(r.mapOutdatedPodToNamespace),
+		onlyIstioInjectedPods(),
+	)
+
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Namespace{}).
 		Named("namespace").
 		WithEventFilter(onlyReconcileIstioRevLabeled()).
 		WatchesRawSource(src).
+		WatchesRawSource(podSrc).
 		WithOptions(controller.Options{
-			MaxConcurrentReconciles: 1,
+			MaxConcurrentReconciles: max(r.Config.MaxConcurrentReconciles, 1),
 			RateLimiter:             r.namespaceControllerRateLimiter(),
-		}).
-		Complete(r)
+		})
+	if resync := r.resyncSource(r.Config.ResyncPeriod); resync != nil {
+		builder = builder.WatchesRawSource(resync)
+	}
+	return builder.Complete(r)
 }
 
 // filter namespace events we want to reconcile
@@ -255,18 +716,34 @@ func (r *NamespaceReconciler) webhookEventHandlers() handler.TypedFuncs[*admissi
 		},
 		UpdateFunc: func(ctx context.Context, e event.TypedUpdateEvent[*admissionregistrationv1.MutatingWebhookConfiguration], q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
 			var log = log.FromContext(ctx)
-			log.Info("Reconciling Update for Webhook", "name", e.ObjectNew.Name)
-			for _, nsRec := range r.reconcileWebhookConfig(ctx, e.ObjectNew) {
+			var changes = webhookChanges(e.ObjectOld, e.ObjectNew)
+			if len(changes) == 0 {
+				log.Info("Ignoring Update for Webhook, nothing affecting istio revisions changed", "name", e.ObjectNew.Name)
+				return
+			}
+			log.Info("Reconciling Update for Webhook", "name", e.ObjectNew.Name, "changes", changes)
+			var nsRecs = r.reconcileWebhookConfig(ctx, e.ObjectNew)
+			r.startCampaign(ctx, e.ObjectOld, e.ObjectNew, nsRecs)
+			for _, nsRec := range nsRecs {
+				q.Add(nsRec)
+			}
+			// namespaces using the old tag need another look too, as do those of a webhook that's
+			// no longer an istio webhook
+			if webhookLabelValue(e.ObjectOld) != webhookLabelValue(e.ObjectNew) || !isIstioWebhook(e.ObjectNew) {
+				for _, nsRec := range r.reconcileWebhookConfig(ctx, e.ObjectOld) {
+					q.Add(nsRec)
+				}
+			}
+		},
+		DeleteFunc: func(ctx context.Context, e event.TypedDeleteEvent[*admissionregistrationv1.MutatingWebhookConfiguration], q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			// namespaces still using the webhook's tag have lost sidecar injection
+			var log = log.FromContext(ctx)
+			log.Info("Reconciling Delete for Webhook", "name", e.Object.Name)
+			for _, nsRec := range r.reconcileWebhookConfig(ctx, e.Object) {
 				q.Add(nsRec)
 			}
 		},
 		/*
-			DeleteFunc: func(ctx context.Context, e event.TypedDeleteEvent[*admissionregistrationv1.MutatingWebhookConfiguration], q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
-				q.Add(reconcile.Request{NamespacedName: types.NamespacedName{
-					Name:      e.Object.Name,
-					Namespace: e.Object.Namespace,
-				}})
-			},
 			GenericFunc: func(ctx context.Context, e event.TypedGenericEvent[*admissionregistrationv1.MutatingWebhookConfiguration], q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
 				q.Add(reconcile.Request{NamespacedName: types.NamespacedName{
 					Name:      e.Object.Name,
@@ -281,10 +758,21 @@ func (r *NamespaceReconciler) webhookEventHandlers() handler.TypedFuncs[*admissi
 // all istio webhooks should have this "app" label value
 const webhookAppLabelValue = "sidecar-injector"
 
-// the webhooks we're interested in...
-func isIstioTaggedWebhook(o client.Object) bool {
+// the webhooks we're interested in: those of istio tags, and of the revisions themselves, which
+// namespaces can also use directly
+func isIstioWebhook(o client.Object) bool {
 	labels := o.GetLabels()
-	return labels["app"] == webhookAppLabelValue && labels[common.IstioTagLabel] != ""
+	return labels["app"] == webhookAppLabelValue &&
+		(labels[common.IstioTagLabel] != "" || labels[common.IstioRevLabel] != "")
+}
+
+// webhookLabelValue returns the value namespaces use in their istio label to select the webhook:
+// its tag, or for revision webhooks, its revision
+func webhookLabelValue(webhook client.Object) string {
+	if tag := webhook.GetLabels()[common.IstioTagLabel]; tag != "" {
+		return tag
+	}
+	return webhook.GetLabels()[common.IstioRevLabel]
 }
 
 func (r *NamespaceReconciler) reconcileWebhookConfig(ctx context.Context,
@@ -294,16 +782,16 @@ func (r *NamespaceReconciler) reconcileWebhookConfig(ctx context.Context,
 	var tag = webhook.Labels[common.IstioTagLabel] // canary, stable, default, etc...
 	var rev = webhook.Labels[common.IstioRevLabel] // istiod instance revision
 
-	if !isIstioTaggedWebhook(webhook) {
+	if !isIstioWebhook(webhook) {
 		return []reconcile.Request{}
 	}
 
 	log.Info("Istio Webhook Found", "webhookName", webhook.Name, "istioTag", tag, "istioRev", rev)
 
-	// find namespaces that use this webhook's tag
+	// find namespaces that use this webhook's tag, or its revision directly
 	var nsList = &corev1.NamespaceList{}
 	err := r.List(ctx, nsList, &client.ListOptions{
-		LabelSelector: labels.Set{common.IstioRevLabel: tag}.AsSelector(),
+		LabelSelector: labels.Set{common.IstioRevLabel: webhookLabelValue(webhook)}.AsSelector(),
 	})
 	if err != nil {
 		log.Error(err, "Failed to get list of namespaces labeled for istio revision",
@@ -326,31 +814,22 @@ func (r *NamespaceReconciler) reconcileWebhookConfig(ctx context.Context,
 func onlyReconcileIstioWebhooks() predicate.TypedPredicate[*admissionregistrationv1.MutatingWebhookConfiguration] {
 	return predicate.TypedFuncs[*admissionregistrationv1.MutatingWebhookConfiguration]{
 		CreateFunc: func(e event.TypedCreateEvent[*admissionregistrationv1.MutatingWebhookConfiguration]) bool {
-			return isIstioTaggedWebhook(e.Object)
+			return isIstioWebhook(e.Object)
 		},
 		UpdateFunc: func(e event.TypedUpdateEvent[*admissionregistrationv1.MutatingWebhookConfiguration]) bool {
-			return isIstioTaggedWebhook(e.ObjectNew)
+			// a webhook losing its tag matters as much as one gaining it
+			return isIstioWebhook(e.ObjectOld) || isIstioWebhook(e.ObjectNew)
 		},
 		DeleteFunc: func(e event.TypedDeleteEvent[*admissionregistrationv1.MutatingWebhookConfiguration]) bool {
-			return isIstioTaggedWebhook(e.Object)
+			return isIstioWebhook(e.Object)
 		},
 		GenericFunc: func(e event.TypedGenericEvent[*admissionregistrationv1.MutatingWebhookConfiguration]) bool {
-			return isIstioTaggedWebhook(e.Object)
+			return isIstioWebhook(e.Object)
 		},
 	}
 }
 
+// restarts are paced by the governor, so this only slows down retries of failed reconciles
 func (r *NamespaceReconciler) namespaceControllerRateLimiter() workqueue.TypedRateLimiter[reconcile.Request] {
-	// TODO: figure out how to implement desired rate-limiting semantics here...
-	// for example: only perform 5 restarts every minute, and no more than 5 active restarts at a time
-	var restartsPerMinute = r.Config.RestartsPerMinute
-	var activeRestartLimit = r.Config.ActiveRestartLimit
-
-	limit := rate.Limit(1.0 / (60.0 / restartsPerMinute))
-	limiter := rate.NewLimiter(limit, activeRestartLimit)
-	return workqueue.NewTypedMaxOfRateLimiter(
-		workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](5*time.Second, 1000*time.Second),
-		// This is only for retry speed and its only the overall factor (not per item)
-		&workqueue.TypedBucketRateLimiter[reconcile.Request]{Limiter: limiter},
-	)
+	return workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](5*time.Second, 1000*time.Second)
 }
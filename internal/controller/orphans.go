@@ -0,0 +1,92 @@
+package controller
+
+// Sidecars keep running after the control plane of their revision is uninstalled, but they don't
+// get any config updates anymore. We call them orphaned proxies, and since they're the riskiest
+// outdated pods there are, they can be restarted ahead of everything else.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/metrics"
+)
+
+// status board section listing orphaned proxies
+const orphanedSection = "orphanedProxies"
+
+// how many pod names to list in Events
+const maxPodsInEvent = 5
+
+// OrphanedProxies lists the pods in a namespace running sidecars of a revision that's gone
+type OrphanedProxies struct {
+	// pod names by revision
+	Pods map[string][]string `json:"pods"`
+}
+
+// knownRevisions returns the istio revisions that have a webhook or an istiod Deployment
+func (r *NamespaceReconciler) knownRevisions(ctx context.Context) (map[string]bool, error) {
+	installed, err := installedRevisions(ctx, r.Client)
+	if err != nil {
+		return nil, err
+	}
+	var revs = make(map[string]bool, len(installed))
+	for rev := range installed {
+		revs[rev] = true
+	}
+	return revs, nil
+}
+
+// isOrphanedPod returns true if the pod's sidecar is from a revision that's gone
+func isOrphanedPod(pod metav1.PartialObjectMetadata, knownRevs map[string]bool) bool {
+	var rev = pod.Annotations[common.IstioRevLabel]
+	return rev != "" && !knownRevs[rev]
+}
+
+// reportOrphanedProxies reports the orphaned proxies in a namespace with an Event, a metric and an
+// entry on the status board, or clears the report if there are none
+func (r *NamespaceReconciler) reportOrphanedProxies(ctx context.Context, ns *corev1.Namespace,
+	pods []metav1.PartialObjectMetadata, knownRevs map[string]bool) {
+	var log = log.FromContext(ctx)
+
+	var orphans = make(map[string][]string)
+	for _, pod := range pods {
+		if isOrphanedPod(pod, knownRevs) {
+			var rev = pod.Annotations[common.IstioRevLabel]
+			orphans[rev] = append(orphans[rev], pod.Name)
+		}
+	}
+
+	r.clearOrphanedProxies(ns.Name)
+	if len(orphans) == 0 {
+		return
+	}
+
+	r.Status.Set(orphanedSection, ns.Name, OrphanedProxies{Pods: orphans})
+	for rev, podNames := range orphans {
+		sort.Strings(podNames)
+		log.Info("Pods are running sidecars of an istio revision whose control plane is gone",
+			"ns", ns.Name, "podRev", rev, "pods", len(podNames))
+		metrics.OrphanedProxies.WithLabelValues(ns.Name, rev).Set(float64(len(podNames)))
+
+		var listed = podNames
+		if len(listed) > maxPodsInEvent {
+			listed = listed[:maxPodsInEvent]
+		}
+		r.Recorder.Event(ns, corev1.EventTypeWarning, "OrphanedProxies", fmt.Sprintf(
+			"%d pods run sidecars of istio revision %v, which has no webhook or istiod, so they get no config updates: %v",
+			len(podNames), rev, strings.Join(listed, ", ")))
+	}
+}
+
+// clearOrphanedProxies removes any report of orphaned proxies in the namespace
+func (r *NamespaceReconciler) clearOrphanedProxies(nsName string) {
+	r.Status.Delete(orphanedSection, nsName)
+	metrics.OrphanedProxies.DeletePartialMatch(map[string]string{"namespace": nsName})
+}
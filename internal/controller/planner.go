@@ -0,0 +1,147 @@
+package controller
+
+// Outdated pods in a namespace are restarted in an order made of the criteria in RestartOrder,
+// most important first. Each criterion only breaks the ties left by the ones before it, and pods
+// that tie on all of them keep the order they were listed in.
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/config"
+)
+
+// labels and annotations gateway pods are recognized by
+const (
+	// label istio's gateway charts put on gateway pods
+	istioGatewayLabel = "istio"
+
+	// label the Gateway API puts on the pods of gateways it deploys
+	gatewayNameLabel = "gateway.networking.k8s.io/gateway-name"
+
+	// annotation selecting the injection templates, which is "gateway" for injected gateways
+	injectTemplatesAnnotation = "inject.istio.io/templates"
+)
+
+// podRank is what an outdated pod is ordered by
+type podRank struct {
+	orphaned      bool
+	advisory      int
+	skew          int
+	priority      int
+	priorityClass int32
+	gateway       bool
+}
+
+// rankBefore returns true if a pod ranked a should be restarted before one ranked b, going by the
+// given criteria in order
+func rankBefore(order []string, a, b podRank) bool {
+	for _, criterion := range order {
+		switch criterion {
+		case config.RestartOrderOrphaned:
+			if a.orphaned != b.orphaned {
+				return a.orphaned
+			}
+		case config.RestartOrderAdvisory:
+			if a.advisory != b.advisory {
+				return a.advisory > b.advisory
+			}
+		case config.RestartOrderSkew:
+			if a.skew != b.skew {
+				return a.skew > b.skew
+			}
+		case config.RestartOrderPriority:
+			if a.priority != b.priority {
+				return a.priority > b.priority
+			}
+		case config.RestartOrderPriorityClass:
+			if a.priorityClass != b.priorityClass {
+				return a.priorityClass > b.priorityClass
+			}
+		case config.RestartOrderGatewaysLast:
+			if a.gateway != b.gateway {
+				return b.gateway
+			}
+		}
+	}
+	return false
+}
+
+// isGatewayPod returns true if the pod runs an istio ingress or egress gateway
+func isGatewayPod(pod metav1.PartialObjectMetadata) bool {
+	switch pod.Labels[istioGatewayLabel] {
+	case "ingressgateway", "egressgateway":
+		return true
+	}
+	if _, ok := pod.Labels[gatewayNameLabel]; ok {
+		return true
+	}
+	return strings.Contains(pod.Annotations[injectTemplatesAnnotation], "gateway")
+}
+
+// podPriority returns the priority annotated on the pod's controller, or failing that, on the pod
+func (r *NamespaceReconciler) podPriority(ctx context.Context, pod metav1.PartialObjectMetadata, run *namespaceRun) int {
+	var log = log.FromContext(ctx)
+
+	var value, ok = pod.Annotations[common.PriorityAnnotation]
+	if owner, err := run.finder.FindPodControllerMetadata(ctx, pod); err == nil {
+		if ownerValue, found := owner.Annotations[common.PriorityAnnotation]; found {
+			value, ok = ownerValue, true
+		}
+	}
+	if !ok {
+		return 0
+	}
+	priority, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		log.Info("Ignoring invalid priority annotation",
+			"ns", pod.Namespace, "pod", pod.Name, "annotation", common.PriorityAnnotation, "value", value)
+		return 0
+	}
+	return priority
+}
+
+// planRestarts orders the outdated pods by the configured criteria. Pods that aren't outdated
+// don't need ranking, and are left after them.
+func (r *NamespaceReconciler) planRestarts(ctx context.Context, pods []metav1.PartialObjectMetadata, run *namespaceRun) {
+	var order = r.Config.RestartOrder
+	var ranks = make(map[types.UID]podRank, len(pods))
+	for _, pod := range pods {
+		if !isOutdatedPod(pod, run.desiredRev) {
+			continue
+		}
+		var rank = podRank{
+			orphaned: r.Config.PrioritizeOrphanedProxies && isOrphanedPod(pod, run.knownRevs),
+			advisory: run.vulnerable[pod.UID],
+			skew:     run.skew[pod.UID],
+			gateway:  isGatewayPod(pod),
+		}
+		for _, criterion := range order {
+			switch criterion {
+			case config.RestartOrderPriority:
+				rank.priority = r.podPriority(ctx, pod, run)
+			case config.RestartOrderPriorityClass:
+				if details, ok := r.podDetails(ctx, pod); ok {
+					rank.priorityClass = details.priority
+				}
+			}
+		}
+		ranks[pod.UID] = rank
+	}
+
+	sort.SliceStable(pods, func(i, j int) bool {
+		rankI, outdatedI := ranks[pods[i].UID]
+		rankJ, outdatedJ := ranks[pods[j].UID]
+		if outdatedI != outdatedJ {
+			return outdatedI
+		}
+		return rankBefore(order, rankI, rankJ)
+	})
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/hercynium/istio-fortsa/internal/config"
+)
+
+var _ = Describe("Restart planner", func() {
+	var order = []string{config.RestartOrderAdvisory, config.RestartOrderPriority, config.RestartOrderGatewaysLast}
+
+	DescribeTable("which of two pods is restarted first",
+		func(a, b podRank, expected bool) {
+			Expect(rankBefore(order, a, b)).To(Equal(expected))
+		},
+		Entry("more vulnerable first", podRank{advisory: 3}, podRank{advisory: 1, priority: 10}, true),
+		Entry("then higher priority", podRank{priority: 10, gateway: true}, podRank{priority: 5}, true),
+		Entry("then gateways last", podRank{gateway: true}, podRank{}, false),
+		Entry("unconfigured criteria are ignored", podRank{skew: 1}, podRank{}, false),
+		Entry("ties keep their order", podRank{}, podRank{}, false),
+	)
+
+	It("should recognize gateway pods", func() {
+		var pod = func(labels, annotations map[string]string) metav1.PartialObjectMetadata {
+			return metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Labels: labels, Annotations: annotations}}
+		}
+		Expect(isGatewayPod(pod(map[string]string{"istio": "ingressgateway"}, nil))).To(BeTrue())
+		Expect(isGatewayPod(pod(map[string]string{gatewayNameLabel: "public"}, nil))).To(BeTrue())
+		Expect(isGatewayPod(pod(nil, map[string]string{injectTemplatesAnnotation: "gateway"}))).To(BeTrue())
+		Expect(isGatewayPod(pod(map[string]string{"app": "web"}, nil))).To(BeFalse())
+	})
+})
@@ -0,0 +1,116 @@
+package controller
+
+// Only pod metadata is cached, so the few things needed from pods' specs have to be read from the
+// API server. They never change for the life of a pod, so they're only read once for each pod.
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// name of the sidecar container
+const istioProxyContainer = "istio-proxy"
+
+// podDetail holds what's needed from a pod's spec
+type podDetail struct {
+	// image of the sidecar container
+	proxyImage string
+
+	// priority from the pod's PriorityClass
+	priority int32
+}
+
+// podDetails returns what's needed from the pod's spec. The first time a pod in a namespace is
+// asked about, the spec of every pod in the namespace is read with a single list, rather than
+// each pod being read on its own.
+func (r *NamespaceReconciler) podDetails(ctx context.Context, pod metav1.PartialObjectMetadata) (podDetail, bool) {
+	r.podDetailsMu.Lock()
+	details, ok := r.podDetailCache[pod.Namespace][pod.UID]
+	r.podDetailsMu.Unlock()
+	if ok {
+		return details, true
+	}
+
+	if err := r.loadPodDetails(ctx, pod.Namespace); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to read pods", "ns", pod.Namespace)
+		return podDetail{}, false
+	}
+
+	r.podDetailsMu.Lock()
+	defer r.podDetailsMu.Unlock()
+	details, ok = r.podDetailCache[pod.Namespace][pod.UID]
+	if !ok {
+		// the pod's gone, or been replaced by another with the same name, so don't list again for it
+		r.podDetailCache[pod.Namespace][pod.UID] = podDetail{}
+	}
+	return details, ok
+}
+
+// how many pods to read at a time when loading their specs
+const podDetailsPageSize = 500
+
+// loadPodDetails reads the specs of every pod in the namespace
+func (r *NamespaceReconciler) loadPodDetails(ctx context.Context, namespace string) error {
+	var loaded = make(map[types.UID]podDetail)
+	var opts = []client.ListOption{client.InNamespace(namespace), client.Limit(podDetailsPageSize)}
+	for {
+		var pods = &corev1.PodList{}
+		if err := r.apiReader.List(ctx, pods, opts...); err != nil {
+			return err
+		}
+		for i := range pods.Items {
+			loaded[pods.Items[i].UID] = newPodDetail(&pods.Items[i])
+		}
+		if pods.Continue == "" {
+			break
+		}
+		opts = []client.ListOption{client.InNamespace(namespace), client.Limit(podDetailsPageSize), client.Continue(pods.Continue)}
+	}
+
+	r.podDetailsMu.Lock()
+	defer r.podDetailsMu.Unlock()
+	if r.podDetailCache[namespace] == nil {
+		r.podDetailCache[namespace] = make(map[types.UID]podDetail, len(loaded))
+	}
+	for uid, details := range loaded {
+		r.podDetailCache[namespace][uid] = details
+	}
+	return nil
+}
+
+// newPodDetail returns what's needed from the pod's spec
+func newPodDetail(pod *corev1.Pod) podDetail {
+	var details podDetail
+	if pod.Spec.Priority != nil {
+		details.priority = *pod.Spec.Priority
+	}
+	for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		if container.Name == istioProxyContainer {
+			details.proxyImage = container.Image
+		}
+	}
+	return details
+}
+
+// forgetPodDetails forgets the details of pods in the namespace that are gone
+func (r *NamespaceReconciler) forgetPodDetails(namespace string, pods []metav1.PartialObjectMetadata) {
+	r.podDetailsMu.Lock()
+	defer r.podDetailsMu.Unlock()
+	var current = make(map[types.UID]bool, len(pods))
+	for _, pod := range pods {
+		current[pod.UID] = true
+	}
+	for uid := range r.podDetailCache[namespace] {
+		if !current[uid] {
+			delete(r.podDetailCache[namespace], uid)
+		}
+	}
+	if len(r.podDetailCache[namespace]) == 0 {
+		delete(r.podDetailCache, namespace)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("Pod details", func() {
+	var ctx = context.Background()
+
+	newPod := func(name, image string, priority int32) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name, UID: types.UID(name + "-uid")},
+			Spec: corev1.PodSpec{
+				Priority: &priority,
+				Containers: []corev1.Container{
+					{Name: "app", Image: "example.com/app:1.0"},
+					{Name: istioProxyContainer, Image: image},
+				},
+			},
+		}
+	}
+
+	asMetadata := func(pod *corev1.Pod) metav1.PartialObjectMetadata {
+		return metav1.PartialObjectMetadata{ObjectMeta: pod.ObjectMeta}
+	}
+
+	It("should read every pod in a namespace with one list, and only once", func() {
+		var lists, gets int
+		web, db := newPod("web", "docker.io/istio/proxyv2:1.24.1", 0), newPod("db", "docker.io/istio/proxyv2:1.23.0", 1000)
+		reader := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithObjects(web, db).
+			WithInterceptorFuncs(interceptor.Funcs{
+				List: func(ctx context.Context, c ctrlclient.WithWatch, list ctrlclient.ObjectList, opts ...ctrlclient.ListOption) error {
+					lists++
+					return c.List(ctx, list, opts...)
+				},
+				Get: func(ctx context.Context, c ctrlclient.WithWatch, key ctrlclient.ObjectKey,
+					obj ctrlclient.Object, opts ...ctrlclient.GetOption) error {
+					gets++
+					return c.Get(ctx, key, obj, opts...)
+				},
+			}).
+			Build()
+		r := &NamespaceReconciler{apiReader: reader, podDetailCache: make(map[string]map[types.UID]podDetail)}
+
+		details, ok := r.podDetails(ctx, asMetadata(web))
+		Expect(ok).To(BeTrue())
+		Expect(details.proxyImage).To(Equal("docker.io/istio/proxyv2:1.24.1"))
+		details, ok = r.podDetails(ctx, asMetadata(db))
+		Expect(ok).To(BeTrue())
+		Expect(details.priority).To(Equal(int32(1000)))
+		Expect(lists).To(Equal(1))
+
+		// pods that are gone are only listed for once
+		gone := asMetadata(newPod("gone", "", 0))
+		_, ok = r.podDetails(ctx, gone)
+		Expect(ok).To(BeFalse())
+		_, _ = r.podDetails(ctx, gone)
+		Expect(lists).To(Equal(2))
+		Expect(gets).To(BeZero())
+	})
+})
@@ -0,0 +1,69 @@
+package controller
+
+// Pods can come up with an outdated sidecar after their namespace was reconciled, for example when
+// a Deployment is rolled back, an HPA scales up an old ReplicaSet, or a backup is restored. Watching
+// pods as they're created lets us reconcile their namespace again right away.
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+)
+
+// mapOutdatedPodToNamespace returns a request for the pod's namespace if the pod is outdated
+func (r *NamespaceReconciler) mapOutdatedPodToNamespace(ctx context.Context, pod *metav1.PartialObjectMetadata) []reconcile.Request {
+	var log = log.FromContext(ctx)
+
+	var ns = &corev1.Namespace{}
+	err := r.Get(ctx, client.ObjectKey{Name: pod.Namespace}, ns)
+	if err != nil {
+		return nil
+	}
+	if ns.Labels[common.IstioRevLabel] == "" {
+		return nil
+	}
+
+	desiredRev, err := r.getNamespaceDesiredRev(ctx, ns)
+	if err != nil {
+		log.Error(err, "Failed to get istio revision associated with this namespace", "ns", ns.Name)
+		return nil
+	}
+	if desiredRev == "" || !isOutdatedPod(*pod, desiredRev) {
+		return nil
+	}
+
+	log.Info("Outdated pod created, enqueuing namespace", "ns", pod.Namespace, "pod", pod.Name,
+		"nsRev", desiredRev, "podRev", pod.Annotations[common.IstioRevLabel])
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: pod.Namespace}}}
+}
+
+// only pods with istio sidecars can be outdated, and their revision doesn't change once they exist
+func onlyIstioInjectedPods() predicate.TypedPredicate[*metav1.PartialObjectMetadata] {
+	var injected = func(pod *metav1.PartialObjectMetadata) bool {
+		return pod.Annotations[common.IstioRevLabel] != "" && pod.DeletionTimestamp == nil
+	}
+	return predicate.TypedFuncs[*metav1.PartialObjectMetadata]{
+		CreateFunc: func(e event.TypedCreateEvent[*metav1.PartialObjectMetadata]) bool {
+			return injected(e.Object)
+		},
+		UpdateFunc: func(e event.TypedUpdateEvent[*metav1.PartialObjectMetadata]) bool {
+			return injected(e.ObjectNew) &&
+				e.ObjectOld.Annotations[common.IstioRevLabel] != e.ObjectNew.Annotations[common.IstioRevLabel]
+		},
+		DeleteFunc: func(e event.TypedDeleteEvent[*metav1.PartialObjectMetadata]) bool {
+			return false
+		},
+		GenericFunc: func(e event.TypedGenericEvent[*metav1.PartialObjectMetadata]) bool {
+			return injected(e.Object)
+		},
+	}
+}
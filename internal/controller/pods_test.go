@@ -0,0 +1,90 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+)
+
+var _ = Describe("Pod watch", func() {
+	var ctx = context.Background()
+
+	newPod := func(ns, rev string) *metav1.PartialObjectMetadata {
+		var pod = &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "web"}}
+		if rev != "" {
+			pod.Annotations = map[string]string{common.IstioRevLabel: rev}
+		}
+		return pod
+	}
+
+	It("should enqueue the namespace of injected pods on the wrong revision", func() {
+		var tag = &admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{
+			Name: "istio-revision-tag-stable",
+			Labels: map[string]string{
+				"app": webhookAppLabelValue, common.IstioTagLabel: "stable", common.IstioRevLabel: "1-23-0",
+			},
+		}}
+		r := &NamespaceReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(tag,
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app", Labels: map[string]string{common.IstioRevLabel: "stable"}}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "plain"}},
+		).Build()}
+
+		Expect(r.mapOutdatedPodToNamespace(ctx, newPod("app", "1-22-0"))).To(Equal([]reconcile.Request{
+			{NamespacedName: types.NamespacedName{Name: "app"}},
+		}))
+		Expect(r.mapOutdatedPodToNamespace(ctx, newPod("app", "1-23-0"))).To(BeEmpty())
+		Expect(r.mapOutdatedPodToNamespace(ctx, newPod("app", ""))).To(BeEmpty())
+		Expect(r.mapOutdatedPodToNamespace(ctx, newPod("plain", "1-22-0"))).To(BeEmpty())
+		Expect(r.mapOutdatedPodToNamespace(ctx, newPod("gone", "1-22-0"))).To(BeEmpty())
+	})
+
+	It("should only pass events for pods with istio sidecars", func() {
+		var predicate = onlyIstioInjectedPods()
+		var injected, uninjected = newPod("app", "1-22-0"), newPod("app", "")
+
+		Expect(predicate.Create(event.TypedCreateEvent[*metav1.PartialObjectMetadata]{Object: injected})).To(BeTrue())
+		Expect(predicate.Create(event.TypedCreateEvent[*metav1.PartialObjectMetadata]{Object: uninjected})).To(BeFalse())
+		Expect(predicate.Generic(event.TypedGenericEvent[*metav1.PartialObjectMetadata]{Object: uninjected})).To(BeFalse())
+		Expect(predicate.Delete(event.TypedDeleteEvent[*metav1.PartialObjectMetadata]{Object: injected})).To(BeFalse())
+
+		// updates only matter if they change the sidecar's revision
+		Expect(predicate.Update(event.TypedUpdateEvent[*metav1.PartialObjectMetadata]{
+			ObjectOld: injected, ObjectNew: injected,
+		})).To(BeFalse())
+		Expect(predicate.Update(event.TypedUpdateEvent[*metav1.PartialObjectMetadata]{
+			ObjectOld: uninjected, ObjectNew: injected,
+		})).To(BeTrue())
+
+		var deleting = newPod("app", "1-22-0")
+		deleting.DeletionTimestamp = &metav1.Time{}
+		Expect(predicate.Create(event.TypedCreateEvent[*metav1.PartialObjectMetadata]{Object: deleting})).To(BeFalse())
+	})
+})
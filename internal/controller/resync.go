@@ -0,0 +1,70 @@
+package controller
+
+// Namespaces are normally reconciled when their istio label or the istio webhooks change. A
+// periodic resync catches what those events miss, like restarts that failed or pods recreated from
+// an old ReplicaSet, by enqueueing every namespace with the istio label again now and then.
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+)
+
+// how much the time between resyncs varies, as a fraction of the resync period
+const resyncJitterFactor = 0.1
+
+// resyncSource returns a source that enqueues every namespace with the istio label once every
+// period. Each namespace is enqueued after a random delay of up to half the period, so a resync
+// of a large cluster is spread out rather than hitting the API server all at once. It returns nil
+// if the period isn't positive, which disables resyncs.
+func (r *NamespaceReconciler) resyncSource(period time.Duration) source.TypedSource[reconcile.Request] {
+	if period <= 0 {
+		return nil
+	}
+	return source.TypedFunc[reconcile.Request](func(ctx context.Context,
+		q workqueue.TypedRateLimitingInterface[reconcile.Request]) error {
+		go wait.JitterUntilWithContext(ctx, func(ctx context.Context) {
+			r.enqueueIstioNamespaces(ctx, q, period/2)
+		}, period, resyncJitterFactor, false)
+		return nil
+	})
+}
+
+func (r *NamespaceReconciler) enqueueIstioNamespaces(ctx context.Context,
+	q workqueue.TypedRateLimitingInterface[reconcile.Request], spread time.Duration) {
+	var log = log.FromContext(ctx)
+
+	hasRevLabel, err := labels.NewRequirement(common.IstioRevLabel, selection.Exists, nil)
+	if err != nil {
+		log.Error(err, "Failed to build namespace selector for resync")
+		return
+	}
+	var nsList = &corev1.NamespaceList{}
+	err = r.List(ctx, nsList, &client.ListOptions{LabelSelector: labels.NewSelector().Add(*hasRevLabel)})
+	if err != nil {
+		log.Error(err, "Failed to list namespaces to resync")
+		return
+	}
+
+	log.Info("Resyncing namespaces", "namespaces", len(nsList.Items))
+	for _, ns := range nsList.Items {
+		var delay time.Duration
+		if spread > 0 {
+			delay = rand.N(spread)
+		}
+		q.AddAfter(reconcile.Request{NamespacedName: types.NamespacedName{Name: ns.Name}}, delay)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/config"
+)
+
+// delayQueue records the namespaces added to it, and after how long
+type delayQueue struct {
+	workqueue.TypedRateLimitingInterface[reconcile.Request]
+
+	mu    sync.Mutex
+	added map[string]time.Duration
+}
+
+func (q *delayQueue) AddAfter(item reconcile.Request, duration time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.added[item.Name] = duration
+}
+
+func (q *delayQueue) delays() map[string]time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var delays = make(map[string]time.Duration, len(q.added))
+	for name, delay := range q.added {
+		delays[name] = delay
+	}
+	return delays
+}
+
+var _ = Describe("Resync", func() {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var r *NamespaceReconciler
+	var queue *delayQueue
+	var labeled []string
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		DeferCleanup(func() { cancel() })
+
+		var objects []client.Object
+		labeled = nil
+		for i := range 20 {
+			var name = fmt.Sprintf("labeled-%d", i)
+			labeled = append(labeled, name)
+			objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name: name, Labels: map[string]string{common.IstioRevLabel: "stable"},
+			}})
+		}
+		objects = append(objects,
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "unlabeled"}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name: "injection-disabled", Labels: map[string]string{"istio-injection": "disabled"},
+			}},
+		)
+		r = &NamespaceReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build()}
+		queue = &delayQueue{added: make(map[string]time.Duration)}
+	})
+
+	It("should only enqueue namespaces with the istio label", func() {
+		r.enqueueIstioNamespaces(ctx, queue, 0)
+		var delays = queue.delays()
+		Expect(delays).To(HaveLen(len(labeled)))
+		for _, name := range labeled {
+			Expect(delays).To(HaveKeyWithValue(name, time.Duration(0)))
+		}
+	})
+
+	It("should spread the namespaces over half the period", func() {
+		const period = 200 * time.Millisecond
+		var resync = r.resyncSource(period)
+		Expect(resync).NotTo(BeNil())
+		Expect(resync.Start(ctx, queue)).To(Succeed())
+
+		Eventually(queue.delays).Should(HaveLen(len(labeled)))
+		for name, delay := range queue.delays() {
+			Expect(labeled).To(ContainElement(name))
+			Expect(delay).To(BeNumerically("<", period/2))
+		}
+	})
+
+	It("should be disabled by a zero resync period", func() {
+		GinkgoT().Setenv("FORTSA_RESYNCPERIOD", "0")
+		cfg, err := config.GetConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.ResyncPeriod).To(BeZero())
+		Expect(r.resyncSource(cfg.ResyncPeriod)).To(BeNil())
+	})
+})
@@ -0,0 +1,179 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/governor"
+)
+
+var _ = Describe("Retargeting a namespace", func() {
+	var ctx = context.Background()
+	var isController = true
+
+	var c client.Client
+	var r *NamespaceReconciler
+	var recorder *record.FakeRecorder
+	var restarts int
+
+	var webKey = governor.ControllerKey{
+		GroupKind:      schema.GroupKind{Group: "apps", Kind: "Deployment"},
+		NamespacedName: types.NamespacedName{Namespace: "app", Name: "web"},
+	}
+	var dbKey = governor.ControllerKey{
+		GroupKind:      schema.GroupKind{Group: "apps", Kind: "StatefulSet"},
+		NamespacedName: types.NamespacedName{Namespace: "app", Name: "db"},
+	}
+
+	newWebhook := func(name, tag, rev string) *admissionregistrationv1.MutatingWebhookConfiguration {
+		var labels = map[string]string{"app": webhookAppLabelValue, common.IstioRevLabel: rev}
+		if tag != "" {
+			labels[common.IstioTagLabel] = tag
+		}
+		return &admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+
+	// moveTag points the stable tag at another revision
+	moveTag := func(rev string) {
+		var tag = &admissionregistrationv1.MutatingWebhookConfiguration{}
+		Expect(c.Get(ctx, client.ObjectKey{Name: "istio-revision-tag-stable"}, tag)).To(Succeed())
+		tag.Labels[common.IstioRevLabel] = rev
+		Expect(c.Update(ctx, tag)).To(Succeed())
+	}
+
+	reconcile := func() {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "app"}})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var replicas int32 = 1
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "web", UID: "web-uid"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			},
+			Status: appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+		}
+		replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "app", Name: "web-abc", UID: "rs-uid",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "Deployment", Name: "web", UID: deployment.UID, Controller: &isController,
+			}},
+		}}
+		// the pod is left on an old revision throughout, since nothing rolls it out
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "app", Name: "web-abc-1", UID: "pod-uid",
+			Annotations: map[string]string{common.IstioRevLabel: "old"},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-abc", UID: replicaSet.UID, Controller: &isController,
+			}},
+		}}
+
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), meta.RESTScopeNamespace)
+		mapper.Add(appsv1.SchemeGroupVersion.WithKind("ReplicaSet"), meta.RESTScopeNamespace)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("Pod"), meta.RESTScopeNamespace)
+
+		restarts = 0
+		c = newFakeClientBuilder().
+			WithRESTMapper(mapper).
+			WithObjects(deployment, replicaSet, pod,
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app", Labels: map[string]string{common.IstioRevLabel: "stable"}}},
+				newWebhook("istio-revision-tag-stable", "stable", "blue"),
+				newWebhook("istio-sidecar-injector-blue", "", "blue"),
+				newWebhook("istio-sidecar-injector-green", "", "green"),
+			).
+			WithInterceptorFuncs(interceptor.Funcs{
+				Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					if obj.GetName() == "web" {
+						restarts++
+					}
+					return c.Patch(ctx, obj, patch, opts...)
+				},
+			}).
+			Build()
+
+		recorder = record.NewFakeRecorder(100)
+		r = newFakeReconciler(c, recorder)
+	})
+
+	supersededEvents := func() []string {
+		var events []string
+		for {
+			select {
+			case event := <-recorder.Events:
+				if strings.Contains(event, "RestartsSuperseded") {
+					events = append(events, event)
+				}
+			default:
+				return events
+			}
+		}
+	}
+
+	It("should cancel stepwise restarts and replan for the new revision, even when it moves back", func() {
+		reconcile()
+		Expect(restarts).To(Equal(1))
+		Expect(r.ledger.RestartedFor(webKey, "blue")).To(BeTrue())
+
+		// restarted once for the revision, it isn't restarted again
+		reconcile()
+		Expect(restarts).To(Equal(1))
+		Expect(supersededEvents()).To(BeEmpty())
+
+		// a stepwise restart planned for blue is under way when the tag moves to green
+		started, _ := r.governor.TryStart(dbKey, appsv1.SchemeGroupVersion.WithKind("StatefulSet"), false)
+		Expect(started).To(BeTrue())
+		r.governor.SetStepwise(dbKey, true)
+
+		moveTag("green")
+		reconcile()
+		_, active := r.governor.Active(dbKey)
+		Expect(active).To(BeFalse())
+		Expect(supersededEvents()).To(ConsistOf(ContainSubstring("from blue to green")))
+		Expect(restarts).To(Equal(2))
+		Expect(r.ledger.RestartedFor(webKey, "green")).To(BeTrue())
+
+		// moving back to blue plans blue's restarts again, rather than going by the earlier ones
+		moveTag("blue")
+		reconcile()
+		Expect(supersededEvents()).To(ConsistOf(ContainSubstring("from green to blue")))
+		Expect(restarts).To(Equal(3))
+		Expect(r.ledger.RestartedFor(webKey, "blue")).To(BeTrue())
+		Expect(r.ledger.RestartedFor(webKey, "green")).To(BeFalse())
+	})
+})
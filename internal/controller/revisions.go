@@ -0,0 +1,305 @@
+package controller
+
+// After an upgrade, the old istio revision can only be uninstalled once nothing uses it anymore:
+// no pods run its sidecars, no namespace is labeled for it and no tag points at it. The revision
+// report tells which revisions are there yet, and says so with an Event when one gets there.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/k8s"
+	"github.com/hercynium/istio-fortsa/internal/metrics"
+	"github.com/hercynium/istio-fortsa/internal/status"
+)
+
+// label on istiod Deployments
+const istiodAppLabelValue = "istiod"
+
+// status board section with the revision report
+const revisionsSection = "revisions"
+
+// how often the revision report is refreshed
+const revisionReportInterval = time.Minute
+
+// installedRevision is an istio revision with a webhook or an istiod Deployment
+type installedRevision struct {
+	// tags pointing at the revision
+	tags []string
+
+	// the revision's own webhook configuration and istiod Deployment, if they're there
+	webhook *admissionregistrationv1.MutatingWebhookConfiguration
+	istiod  *metav1.PartialObjectMetadata
+}
+
+// object returns the object Events about the revision are attached to
+func (i *installedRevision) object() runtime.Object {
+	if i.webhook != nil {
+		return i.webhook
+	}
+	if i.istiod != nil {
+		return i.istiod
+	}
+	return nil
+}
+
+// installedRevisions returns the istio revisions that have a webhook or an istiod Deployment
+func installedRevisions(ctx context.Context, reader client.Reader) (map[string]*installedRevision, error) {
+	var revs = make(map[string]*installedRevision)
+	var get = func(rev string) *installedRevision {
+		if revs[rev] == nil {
+			revs[rev] = &installedRevision{tags: []string{}}
+		}
+		return revs[rev]
+	}
+
+	var webhooks = &admissionregistrationv1.MutatingWebhookConfigurationList{}
+	err := reader.List(ctx, webhooks, client.MatchingLabels{"app": webhookAppLabelValue})
+	if err != nil {
+		return nil, err
+	}
+	for i, webhook := range webhooks.Items {
+		var rev = webhook.Labels[common.IstioRevLabel]
+		if rev == "" {
+			continue
+		}
+		if tag := webhook.Labels[common.IstioTagLabel]; tag != "" {
+			get(rev).tags = append(get(rev).tags, tag)
+		} else {
+			get(rev).webhook = &webhooks.Items[i]
+		}
+	}
+
+	// only istiod's metadata is needed, so don't cache whole Deployments
+	var deployments = &metav1.PartialObjectMetadataList{}
+	deployments.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("DeploymentList"))
+	err = reader.List(ctx, deployments, client.MatchingLabels{"app": istiodAppLabelValue})
+	if err != nil {
+		return nil, err
+	}
+	for i, deployment := range deployments.Items {
+		if rev := deployment.Labels[common.IstioRevLabel]; rev != "" {
+			var istiod = &deployments.Items[i]
+			istiod.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+			get(rev).istiod = istiod
+		}
+	}
+
+	for _, installed := range revs {
+		sort.Strings(installed.tags)
+	}
+	return revs, nil
+}
+
+// RevisionUsage tells what still uses an installed istio revision
+type RevisionUsage struct {
+	Revision string `json:"revision"`
+
+	// pods running sidecars of the revision, the workloads they belong to, and the namespaces
+	// they're in or that are labeled for the revision
+	Pods       int `json:"pods"`
+	Workloads  int `json:"workloads"`
+	Namespaces int `json:"namespaces"`
+
+	// tags pointing at the revision
+	Tags []string `json:"tags"`
+
+	// nothing uses the revision, so it can be uninstalled
+	Retirable bool `json:"retirable"`
+}
+
+// RevisionReport lists every installed istio revision, and what still uses it
+type RevisionReport struct {
+	GeneratedAt time.Time       `json:"generatedAt"`
+	Revisions   []RevisionUsage `json:"revisions"`
+}
+
+// RevisionReporter works out the revision report. Run by the manager, it refreshes the report
+// every minute, publishing it on the status board and as metrics, and emits an Event when a
+// revision becomes retirable.
+type RevisionReporter struct {
+	// the client to read through, and a mapper to follow pods' owner references with
+	Client client.Reader
+	Mapper meta.RESTMapper
+
+	// Uncached must be set if Client reads straight from the API server, which can't select pods
+	// by their annotations, so every pod has to be listed instead
+	Uncached bool
+
+	Recorder record.EventRecorder
+	Status   *status.Board
+
+	// whether each revision was retirable when last reported
+	retirable map[string]bool
+}
+
+// Start refreshes the report until the context is done
+func (r *RevisionReporter) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		var log = log.FromContext(ctx)
+		if err := r.refresh(ctx); err != nil {
+			log.Error(err, "Failed to report istio revisions")
+		}
+	}, revisionReportInterval)
+	return nil
+}
+
+// Report works out the revision report
+func (r *RevisionReporter) Report(ctx context.Context) (*RevisionReport, error) {
+	report, _, err := r.report(ctx)
+	return report, err
+}
+
+func (r *RevisionReporter) report(ctx context.Context) (*RevisionReport, map[string]*installedRevision, error) {
+	var log = log.FromContext(ctx)
+
+	installed, err := installedRevisions(ctx, r.Client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pods, err := r.listInjectedPods(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var namespaces = &corev1.NamespaceList{}
+	if err := r.Client.List(ctx, namespaces); err != nil {
+		return nil, nil, err
+	}
+
+	var workloads = make(map[string]map[string]bool)
+	var namespacesUsing = make(map[string]map[string]bool)
+	var podCounts = make(map[string]int)
+	var use = func(uses map[string]map[string]bool, rev, key string) {
+		if uses[rev] == nil {
+			uses[rev] = make(map[string]bool)
+		}
+		uses[rev][key] = true
+	}
+
+	var finder = k8s.NewControllerFinder(r.Client, r.Mapper)
+	for _, pod := range pods {
+		var rev = pod.Annotations[common.IstioRevLabel]
+		if installed[rev] == nil {
+			// orphaned proxies are reported on their own
+			continue
+		}
+		podCounts[rev]++
+		use(namespacesUsing, rev, pod.Namespace)
+
+		owner, err := finder.FindPodControllerMetadata(ctx, pod)
+		if err != nil {
+			log.Info("Counting pod as its own workload, since its controller wasn't found",
+				"ns", pod.Namespace, "pod", pod.Name, "error", err.Error())
+			owner = pod.DeepCopy()
+			owner.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Pod"))
+		}
+		use(workloads, rev, fmt.Sprintf("%v/%v/%v", owner.GroupVersionKind().GroupKind(), owner.Namespace, owner.Name))
+	}
+
+	// namespaces labeled for a revision get its sidecars in new pods, even if they have none yet
+	var webhooks = &admissionregistrationv1.MutatingWebhookConfigurationList{}
+	err = r.Client.List(ctx, webhooks, client.MatchingLabels{"app": webhookAppLabelValue})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, ns := range namespaces.Items {
+		var label = ns.Labels[common.IstioRevLabel]
+		if label == "" {
+			continue
+		}
+		if rev, _, _ := resolveRev(label, webhooks.Items); installed[rev] != nil {
+			use(namespacesUsing, rev, ns.Name)
+		}
+	}
+
+	var report = &RevisionReport{GeneratedAt: time.Now(), Revisions: []RevisionUsage{}}
+	for rev, inst := range installed {
+		var usage = RevisionUsage{
+			Revision:   rev,
+			Pods:       podCounts[rev],
+			Workloads:  len(workloads[rev]),
+			Namespaces: len(namespacesUsing[rev]),
+			Tags:       inst.tags,
+		}
+		usage.Retirable = usage.Pods == 0 && usage.Namespaces == 0 && len(usage.Tags) == 0
+		report.Revisions = append(report.Revisions, usage)
+	}
+	sort.Slice(report.Revisions, func(i, j int) bool {
+		return report.Revisions[i].Revision < report.Revisions[j].Revision
+	})
+	return report, installed, nil
+}
+
+// listInjectedPods returns every pod with an istio sidecar in the cluster
+func (r *RevisionReporter) listInjectedPods(ctx context.Context) ([]metav1.PartialObjectMetadata, error) {
+	if !r.Uncached {
+		return k8s.ListInjectedPods(ctx, r.Client, "")
+	}
+
+	var all = k8s.NewPodMetadataList()
+	if err := r.Client.List(ctx, all); err != nil {
+		return nil, err
+	}
+	var pods []metav1.PartialObjectMetadata
+	for _, pod := range all.Items {
+		if pod.Annotations[common.IstioRevLabel] != "" {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// refresh works out the report and publishes it
+func (r *RevisionReporter) refresh(ctx context.Context) error {
+	var log = log.FromContext(ctx)
+
+	report, installed, err := r.report(ctx)
+	if err != nil {
+		return err
+	}
+
+	var findings = make(map[string]any, len(report.Revisions))
+	metrics.RevisionUsers.Reset()
+	var retirable = make(map[string]bool, len(report.Revisions))
+	for _, usage := range report.Revisions {
+		findings[usage.Revision] = usage
+		metrics.RevisionUsers.WithLabelValues(usage.Revision, "pods").Set(float64(usage.Pods))
+		metrics.RevisionUsers.WithLabelValues(usage.Revision, "workloads").Set(float64(usage.Workloads))
+		metrics.RevisionUsers.WithLabelValues(usage.Revision, "namespaces").Set(float64(usage.Namespaces))
+		metrics.RevisionUsers.WithLabelValues(usage.Revision, "tags").Set(float64(len(usage.Tags)))
+		retirable[usage.Revision] = usage.Retirable
+
+		// only report revisions that get there while we're watching, not ones that already were
+		// or that were only just installed
+		if wasRetirable, seen := r.retirable[usage.Revision]; !usage.Retirable || !seen || wasRetirable {
+			continue
+		}
+		log.Info("Nothing uses istio revision anymore, so it can be uninstalled", "rev", usage.Revision)
+		if obj := installed[usage.Revision].object(); obj != nil && r.Recorder != nil {
+			r.Recorder.Event(obj, corev1.EventTypeNormal, "RevisionRetirable", fmt.Sprintf(
+				"No pods, namespaces or tags use istio revision %v anymore, so it can be uninstalled", usage.Revision))
+		}
+	}
+	r.retirable = retirable
+
+	if r.Status != nil {
+		r.Status.Replace(revisionsSection, findings)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+)
+
+var _ = Describe("Revision report", func() {
+	webhook := func(name, tag, rev string) *admissionregistrationv1.MutatingWebhookConfiguration {
+		var labels = map[string]string{"app": webhookAppLabelValue, common.IstioRevLabel: rev}
+		if tag != "" {
+			labels[common.IstioTagLabel] = tag
+		}
+		return &admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+
+	var isController = true
+
+	pod := func(ns, name, rev, rs string) *corev1.Pod {
+		var p = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns, Name: name, Annotations: map[string]string{common.IstioRevLabel: rev},
+		}}
+		if rs != "" {
+			p.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "ReplicaSet", Name: rs, UID: types.UID("rs-uid-" + rs), Controller: &isController,
+			}}
+		}
+		return p
+	}
+
+	It("should count what uses each installed revision", func() {
+		var rs = &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "web", UID: "rs-uid-web"}}
+		var mapper = meta.NewDefaultRESTMapper(nil)
+		mapper.Add(appsv1.SchemeGroupVersion.WithKind("ReplicaSet"), meta.RESTScopeNamespace)
+		var c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRESTMapper(mapper).WithObjects(
+			webhook("istio-sidecar-injector-1-22-0", "", "1-22-0"),
+			webhook("istio-sidecar-injector-1-23-0", "", "1-23-0"),
+			webhook("istio-revision-tag-stable", "stable", "1-23-0"),
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", Labels: map[string]string{common.IstioRevLabel: "stable"}}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "legacy"}},
+			rs,
+			pod("apps", "web-1", "1-23-0", "web"),
+			pod("apps", "web-2", "1-23-0", "web"),
+			pod("legacy", "job", "1-23-0", ""),
+			pod("legacy", "orphan", "1-20-0", ""),
+		).Build()
+
+		var reporter = &RevisionReporter{Client: c, Mapper: mapper, Uncached: true}
+		report, err := reporter.Report(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Revisions).To(Equal([]RevisionUsage{
+			{Revision: "1-22-0", Tags: []string{}, Retirable: true},
+			{Revision: "1-23-0", Pods: 3, Workloads: 2, Namespaces: 2, Tags: []string{"stable"}},
+		}))
+	})
+})
@@ -0,0 +1,134 @@
+package controller
+
+// Istio only supports sidecars a few minor versions behind the control plane they connect to, and
+// none ahead of it. Sidecars outside that range are reported, and their pods are restarted ahead
+// of others, the furthest out first.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/k8s"
+	"github.com/hercynium/istio-fortsa/internal/metrics"
+	"github.com/hercynium/istio-fortsa/internal/version"
+)
+
+// status board section listing workloads out of the supported skew
+const skewSection = "skewedWorkloads"
+
+// SkewedWorkload is a workload whose sidecars are out of the supported skew from their control plane
+type SkewedWorkload struct {
+	Kind                string `json:"kind"`
+	Name                string `json:"name"`
+	Revision            string `json:"revision"`
+	ProxyVersion        string `json:"proxyVersion"`
+	ControlPlaneVersion string `json:"controlPlaneVersion"`
+
+	// how many minor versions the sidecars are behind the control plane, or ahead if negative
+	Skew int `json:"skew"`
+
+	// how many minor versions the sidecars are out of the supported skew
+	OutOfSupport int `json:"outOfSupport"`
+
+	Pods int `json:"pods"`
+}
+
+// minorSkew returns how many minor versions a proxy is behind its control plane, or ahead if
+// negative. A major version counts as a hundred minor ones, since istio hasn't had one yet.
+func minorSkew(proxy, controlPlane version.Version) int {
+	return (controlPlane.Major-proxy.Major)*100 + controlPlane.Minor - proxy.Minor
+}
+
+// outOfSupport returns how many minor versions the skew is outside the supported range
+func (r *NamespaceReconciler) outOfSupport(skew int) int {
+	switch {
+	case skew < 0:
+		return -skew
+	case skew > r.Config.MaxProxySkew:
+		return skew - r.Config.MaxProxySkew
+	default:
+		return 0
+	}
+}
+
+// analyzeSkew compares the version of each pod's sidecar with the control plane of its revision,
+// reports the workloads out of the supported skew, and returns how far out each of their pods is
+func (r *NamespaceReconciler) analyzeSkew(ctx context.Context, ns *corev1.Namespace, pods []metav1.PartialObjectMetadata,
+	versions map[string]version.Version, finder *k8s.ControllerFinder) map[types.UID]int {
+	var log = log.FromContext(ctx)
+
+	var skewed = make(map[types.UID]int)
+	var workloads = make(map[string]*SkewedWorkload)
+	for _, pod := range pods {
+		var rev = pod.Annotations[common.IstioRevLabel]
+		controlPlane, ok := versions[rev]
+		if !ok {
+			// orphaned proxies have no control plane to compare with
+			continue
+		}
+		proxy, ok := r.proxyVersion(ctx, pod, versions)
+		if !ok {
+			continue
+		}
+		var skew = minorSkew(proxy, controlPlane)
+		var out = r.outOfSupport(skew)
+		if out == 0 {
+			continue
+		}
+		skewed[pod.UID] = out
+
+		var kind, name = "Pod", pod.Name
+		if owner, err := finder.FindPodControllerMetadata(ctx, pod); err == nil {
+			kind, name = owner.GroupVersionKind().Kind, owner.Name
+		}
+		var key = fmt.Sprintf("%v/%v", kind, name)
+		if workloads[key] == nil {
+			workloads[key] = &SkewedWorkload{
+				Kind: kind, Name: name, Revision: rev,
+				ProxyVersion: proxy.String(), ControlPlaneVersion: controlPlane.String(),
+				Skew: skew, OutOfSupport: out,
+			}
+		}
+		var workload = workloads[key]
+		workload.Pods++
+		// a workload is as far out as its furthest pod
+		if out > workload.OutOfSupport {
+			workload.ProxyVersion, workload.Skew, workload.OutOfSupport = proxy.String(), skew, out
+		}
+	}
+
+	r.clearSkew(ns.Name)
+	if len(workloads) == 0 {
+		return skewed
+	}
+
+	var report = make([]SkewedWorkload, 0, len(workloads))
+	for _, workload := range workloads {
+		report = append(report, *workload)
+		metrics.SkewedWorkloads.WithLabelValues(ns.Name, workload.Kind, workload.Name,
+			workload.ProxyVersion, workload.ControlPlaneVersion).Set(float64(workload.OutOfSupport))
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].OutOfSupport != report[j].OutOfSupport {
+			return report[i].OutOfSupport > report[j].OutOfSupport
+		}
+		return report[i].Kind+"/"+report[i].Name < report[j].Kind+"/"+report[j].Name
+	})
+	r.Status.Set(skewSection, ns.Name, report)
+	log.Info("Workloads have sidecars out of the supported skew from their control plane",
+		"ns", ns.Name, "workloads", len(report), "maxProxySkew", r.Config.MaxProxySkew)
+	return skewed
+}
+
+// clearSkew removes any report of workloads out of the supported skew in the namespace
+func (r *NamespaceReconciler) clearSkew(nsName string) {
+	r.Status.Delete(skewSection, nsName)
+	metrics.SkewedWorkloads.DeletePartialMatch(map[string]string{"namespace": nsName})
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/config"
+	"github.com/hercynium/istio-fortsa/internal/k8s"
+	"github.com/hercynium/istio-fortsa/internal/status"
+	"github.com/hercynium/istio-fortsa/internal/version"
+)
+
+var _ = Describe("Version skew", func() {
+	var r = &NamespaceReconciler{Config: config.FortsaConfig{MaxProxySkew: 2}}
+
+	DescribeTable("how far out of support sidecars are",
+		func(proxy, controlPlane string, expected int) {
+			p, _ := version.Parse(proxy)
+			cp, _ := version.Parse(controlPlane)
+			Expect(r.outOfSupport(minorSkew(p, cp))).To(Equal(expected))
+		},
+		Entry("same version", "1-23-2", "1.23.0", 0),
+		Entry("within the supported skew", "1-21-0", "1.23.0", 0),
+		Entry("too far behind", "1-19-3", "1.23.0", 2),
+		Entry("ahead of the control plane", "1-24-0", "1.23.4", 1),
+	)
+
+	It("should go by the version of the proxy image, not the revision's name", func() {
+		newPod := func(name, image string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "ns", Name: name, UID: types.UID(name + "-uid"),
+					Annotations: map[string]string{common.IstioRevLabel: "1-23-0"},
+				},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: istioProxyContainer, Image: image}}},
+			}
+		}
+		// a pod whose sidecar was injected with an old image, though its revision says 1.23
+		stale, current := newPod("stale", "docker.io/istio/proxyv2:1.20.1"), newPod("current", "docker.io/istio/proxyv2:1.23.0")
+		reader := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(stale, current).Build()
+		r := &NamespaceReconciler{
+			Config:         config.FortsaConfig{MaxProxySkew: 2},
+			Status:         status.NewBoard(),
+			apiReader:      reader,
+			podDetailCache: make(map[string]map[types.UID]podDetail),
+		}
+		var pods []metav1.PartialObjectMetadata
+		for _, pod := range []*corev1.Pod{stale, current} {
+			pods = append(pods, metav1.PartialObjectMetadata{ObjectMeta: pod.ObjectMeta})
+		}
+		controlPlane, _ := version.Parse("1.23.0")
+
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}}
+		skewed := r.analyzeSkew(context.Background(), ns, pods, map[string]version.Version{"1-23-0": controlPlane},
+			k8s.NewControllerFinder(reader, nil))
+		Expect(skewed).To(Equal(map[types.UID]int{stale.UID: 1}))
+
+		report, ok := r.Status.Get(skewSection, "ns")
+		Expect(ok).To(BeTrue())
+		Expect(report).To(ConsistOf(SkewedWorkload{
+			Kind: "Pod", Name: "stale", Revision: "1-23-0", ProxyVersion: "1.20.1", ControlPlaneVersion: "1.23.0",
+			Skew: 3, OutOfSupport: 1, Pods: 1,
+		}))
+		r.clearSkew("ns")
+	})
+})
@@ -0,0 +1,112 @@
+package controller
+
+// A namespace's istio.io/rev label can name an istio tag, or an istio revision directly. If it
+// names neither, because of a typo or because the tag's webhook was deleted, pods created in the
+// namespace don't get sidecars, so we report it and leave the namespace's pods alone.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/metrics"
+)
+
+// reasons a namespace can be misconfigured, used for Events and metrics
+const (
+	reasonRevisionNotFound   = "IstioRevisionNotFound"
+	reasonTagWithoutRevision = "IstioTagWithoutRevision"
+)
+
+// status board section listing misconfigured namespaces
+const misconfiguredSection = "misconfiguredNamespaces"
+
+// Misconfiguration describes why a namespace's istio label doesn't lead to an istio revision
+type Misconfiguration struct {
+	Label   string    `json:"label"`
+	Reason  string    `json:"reason"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"`
+}
+
+// resolveNamespaceRev returns the istio revision the namespace's istio label leads to, either
+// through a tag or directly. If it doesn't lead to one, it returns why instead.
+func (r *NamespaceReconciler) resolveNamespaceRev(ctx context.Context, ns *corev1.Namespace) (string, *Misconfiguration, error) {
+	var label = ns.Labels[common.IstioRevLabel]
+	if label == "" {
+		return "", nil, nil
+	}
+
+	var webhooks = &admissionregistrationv1.MutatingWebhookConfigurationList{}
+	err := r.List(ctx, webhooks, client.MatchingLabels{"app": webhookAppLabelValue})
+	if err != nil {
+		return "", nil, err
+	}
+	return resolveRev(label, webhooks.Items)
+}
+
+// resolveRev returns the istio revision a namespace label leads to, given the istio webhooks
+func resolveRev(label string, webhooks []admissionregistrationv1.MutatingWebhookConfiguration) (string, *Misconfiguration, error) {
+	// tags take precedence, the same way they do in istio
+	for _, webhook := range webhooks {
+		if webhook.Labels[common.IstioTagLabel] != label {
+			continue
+		}
+		if rev := webhook.Labels[common.IstioRevLabel]; rev != "" {
+			return rev, nil, nil
+		}
+		return "", &Misconfiguration{
+			Label:  label,
+			Reason: reasonTagWithoutRevision,
+			Message: fmt.Sprintf("istio tag %q's webhook %v has no %v label, so its revision is unknown",
+				label, webhook.Name, common.IstioRevLabel),
+		}, nil
+	}
+
+	for _, webhook := range webhooks {
+		if webhook.Labels[common.IstioTagLabel] == "" && webhook.Labels[common.IstioRevLabel] == label {
+			return label, nil, nil
+		}
+	}
+
+	return "", &Misconfiguration{
+		Label:  label,
+		Reason: reasonRevisionNotFound,
+		Message: fmt.Sprintf("%v=%v doesn't match any istio tag or revision webhook, so new pods won't get sidecars",
+			common.IstioRevLabel, label),
+	}, nil
+}
+
+// reportMisconfiguration reports a misconfigured namespace with an Event, a metric and an entry on
+// the status board
+func (r *NamespaceReconciler) reportMisconfiguration(ctx context.Context, ns *corev1.Namespace, misconfig *Misconfiguration) {
+	var log = log.FromContext(ctx)
+
+	// keep the time it was first noticed
+	misconfig.Since = time.Now()
+	if previous, ok := r.Status.Get(misconfiguredSection, ns.Name); ok {
+		if previous := previous.(Misconfiguration); previous.Label == misconfig.Label {
+			misconfig.Since = previous.Since
+		}
+	}
+
+	log.Info("Namespace is misconfigured, not restarting its pods",
+		"ns", ns.Name, "label", misconfig.Label, "reason", misconfig.Reason, "message", misconfig.Message)
+	r.Status.Set(misconfiguredSection, ns.Name, *misconfig)
+	metrics.MisconfiguredNamespaces.DeletePartialMatch(prometheus.Labels{"namespace": ns.Name})
+	metrics.MisconfiguredNamespaces.WithLabelValues(ns.Name, misconfig.Label, misconfig.Reason).Set(1)
+	r.Recorder.Event(ns, corev1.EventTypeWarning, misconfig.Reason, misconfig.Message+". Not restarting outdated pods.")
+}
+
+// clearMisconfiguration removes any report of the namespace being misconfigured
+func (r *NamespaceReconciler) clearMisconfiguration(nsName string) {
+	r.Status.Delete(misconfiguredSection, nsName)
+	metrics.MisconfiguredNamespaces.DeletePartialMatch(prometheus.Labels{"namespace": nsName})
+}
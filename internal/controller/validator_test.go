@@ -0,0 +1,76 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+)
+
+// these don't need a test environment, so they're plain tests rather than specs in the
+// envtest suite
+func TestResolveRev(t *testing.T) {
+	newWebhookConfig := func(name, tag, rev string) admissionregistrationv1.MutatingWebhookConfiguration {
+		var labels = map[string]string{"app": webhookAppLabelValue}
+		if tag != "" {
+			labels[common.IstioTagLabel] = tag
+		}
+		if rev != "" {
+			labels[common.IstioRevLabel] = rev
+		}
+		return admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+
+	var webhooks = []admissionregistrationv1.MutatingWebhookConfiguration{
+		newWebhookConfig("istio-revision-tag-stable", "stable", "1-22-0"),
+		newWebhookConfig("istio-revision-tag-broken", "broken", ""),
+		newWebhookConfig("istio-sidecar-injector-1-22-0", "", "1-22-0"),
+		newWebhookConfig("istio-sidecar-injector-1-23-0", "", "1-23-0"),
+	}
+
+	for _, tc := range []struct {
+		name   string
+		label  string
+		rev    string
+		reason string
+	}{
+		{name: "tags resolve to their revision", label: "stable", rev: "1-22-0"},
+		{name: "revisions can be used directly", label: "1-23-0", rev: "1-23-0"},
+		{name: "labels matching no tag or revision", label: "stabel", reason: reasonRevisionNotFound},
+		{name: "tags without a revision", label: "broken", reason: reasonTagWithoutRevision},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			rev, misconfig, err := resolveRev(tc.label, webhooks)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(rev).To(Equal(tc.rev))
+			if tc.reason == "" {
+				g.Expect(misconfig).To(BeNil())
+			} else {
+				g.Expect(misconfig).NotTo(BeNil())
+				g.Expect(misconfig.Reason).To(Equal(tc.reason))
+			}
+		})
+	}
+}
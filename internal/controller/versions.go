@@ -0,0 +1,138 @@
+package controller
+
+// Revision names don't say which way a change goes, but they usually carry the istio version, as
+// in 1-23-2. Restarting pods onto an older version than their sidecars have has to be allowed
+// explicitly, and upgrades can be left to be done by hand, separately for minor and patch ones.
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/config"
+	"github.com/hercynium/istio-fortsa/internal/governor"
+	"github.com/hercynium/istio-fortsa/internal/k8s"
+	"github.com/hercynium/istio-fortsa/internal/version"
+)
+
+// label istio's helm charts put the istio version in
+const istioVersionLabel = "app.kubernetes.io/version"
+
+// revisionVersions returns the istio version of each installed revision, from its istiod's
+// version label if it has one, and otherwise from the revision's name
+func (r *NamespaceReconciler) revisionVersions(ctx context.Context) (map[string]version.Version, error) {
+	installed, err := installedRevisions(ctx, r.Client)
+	if err != nil {
+		return nil, err
+	}
+	var versions = make(map[string]version.Version, len(installed))
+	for rev, inst := range installed {
+		if inst.istiod != nil {
+			if v, ok := version.Parse(inst.istiod.Labels[istioVersionLabel]); ok {
+				versions[rev] = v
+				continue
+			}
+		}
+		if v, ok := version.Parse(rev); ok {
+			versions[rev] = v
+		}
+	}
+	return versions, nil
+}
+
+// proxyVersion returns the istio version of the pod's sidecar: the version in its proxy image's
+// tag, which is what it's actually running, or failing that, the version in its revision's name,
+// or failing that, its revision's version
+func (r *NamespaceReconciler) proxyVersion(ctx context.Context, pod metav1.PartialObjectMetadata,
+	versions map[string]version.Version) (version.Version, bool) {
+	if v, ok := r.imageVersion(ctx, pod); ok {
+		return v, true
+	}
+	var rev = pod.Annotations[common.IstioRevLabel]
+	if v, ok := version.Parse(rev); ok {
+		return v, true
+	}
+	v, ok := versions[rev]
+	return v, ok
+}
+
+// imageVersion returns the version in the tag of the pod's proxy image
+func (r *NamespaceReconciler) imageVersion(ctx context.Context, pod metav1.PartialObjectMetadata) (version.Version, bool) {
+	details, ok := r.podDetails(ctx, pod)
+	if !ok || details.proxyImage == "" {
+		return version.Version{}, false
+	}
+	return version.FromImage(details.proxyImage)
+}
+
+// allowsVersionChange returns true if the policy allows restarting pods moving from one istio
+// version to another, or the reason it doesn't
+func (r *NamespaceReconciler) allowsVersionChange(ns *corev1.Namespace, from, to version.Version) (bool, string) {
+	switch version.Classify(from, to) {
+	case version.Downgrade:
+		if r.Config.AllowDowngrades || ns.Annotations[common.AllowDowngradeAnnotation] == "true" {
+			return true, ""
+		}
+		return false, fmt.Sprintf("it would downgrade the sidecar from %v to %v, which needs the namespace annotated with %v=true",
+			from, to, common.AllowDowngradeAnnotation)
+	case version.MajorUpgrade, version.MinorUpgrade:
+		if r.Config.MinorUpgradePolicy == config.UpgradePolicySkip {
+			return false, fmt.Sprintf("minor and major upgrades, like %v to %v, are skipped", from, to)
+		}
+	case version.PatchUpgrade:
+		if r.Config.PatchUpgradePolicy == config.UpgradePolicySkip {
+			return false, fmt.Sprintf("patch upgrades, like %v to %v, are skipped", from, to)
+		}
+	}
+	return true, ""
+}
+
+// applyVersionPolicy returns the pods the version policy allows restarting, along with the
+// controllers of those it doesn't. Pods whose versions can't be worked out are allowed.
+func (r *NamespaceReconciler) applyVersionPolicy(ctx context.Context, ns *corev1.Namespace, pods []metav1.PartialObjectMetadata,
+	desiredRev string, versions map[string]version.Version,
+	finder *k8s.ControllerFinder) ([]metav1.PartialObjectMetadata, map[governor.ControllerKey]bool) {
+	var log = log.FromContext(ctx)
+
+	var blocked = make(map[governor.ControllerKey]bool)
+	var target, ok = versions[desiredRev]
+	if !ok {
+		if target, ok = version.Parse(desiredRev); !ok {
+			return pods, blocked
+		}
+	}
+
+	var allowed = make([]metav1.PartialObjectMetadata, 0, len(pods))
+	var reasons = make(map[string]bool)
+	for _, pod := range pods {
+		if !isOutdatedPod(pod, desiredRev) {
+			allowed = append(allowed, pod)
+			continue
+		}
+		current, ok := r.proxyVersion(ctx, pod, versions)
+		if !ok {
+			allowed = append(allowed, pod)
+			continue
+		}
+		if ok, reason := r.allowsVersionChange(ns, current, target); !ok {
+			log.Info("Not restarting outdated pod, since "+reason,
+				"ns", pod.Namespace, "pod", pod.Name, "podRev", pod.Annotations[common.IstioRevLabel], "nsRev", desiredRev)
+			reasons[reason] = true
+			if owner, err := finder.FindPodControllerMetadata(ctx, pod); err == nil {
+				blocked[governor.KeyOf(owner)] = true
+			}
+			continue
+		}
+		allowed = append(allowed, pod)
+	}
+
+	for reason := range reasons {
+		r.Recorder.Event(ns, corev1.EventTypeWarning, "RestartBlockedByVersionPolicy", fmt.Sprintf(
+			"Outdated pods weren't restarted onto istio revision %v, since %v", desiredRev, reason))
+	}
+	return allowed, blocked
+}
@@ -0,0 +1,152 @@
+package controller
+
+// Namespaces labelled fortsa.scaffidi.net/wave are restarted a wave at a time, lowest first. Pods
+// in a namespace aren't restarted until every namespace in an earlier wave is settled and has
+// baked for WaveBakeTime. Namespaces without the label aren't held up, and don't hold up others.
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+	"github.com/hercynium/istio-fortsa/internal/governor"
+)
+
+// status board section showing the progress of namespaces in waves
+const wavesSection = "waves"
+
+// how long to wait before checking again on earlier waves that haven't settled
+const waveRequeueInterval = 30 * time.Second
+
+// WaveProgress is how far a namespace in a wave has got
+type WaveProgress struct {
+	Wave    int  `json:"wave"`
+	Settled bool `json:"settled"`
+
+	// when the namespace was seen to become settled, or first seen settled
+	SettledSince *time.Time `json:"settledSince,omitempty"`
+
+	// namespaces in earlier waves its restarts are waiting on
+	WaitingOn []string `json:"waitingOn,omitempty"`
+
+	// outdated pods that won't be restarted, and so don't keep the namespace from settling
+	Stuck []string `json:"stuck,omitempty"`
+}
+
+// namespaceWave returns the wave the namespace is in, if it's labelled with a valid one
+func namespaceWave(ctx context.Context, ns *corev1.Namespace) (int, bool) {
+	var value, ok = ns.Labels[common.WaveLabel]
+	if !ok {
+		return 0, false
+	}
+	wave, err := strconv.Atoi(value)
+	if err != nil {
+		log.FromContext(ctx).Info("Ignoring invalid wave label on namespace",
+			"ns", ns.Name, "label", common.WaveLabel, "value", value)
+		return 0, false
+	}
+	return wave, true
+}
+
+// waveBlockers returns the namespaces in earlier waves that restarts in this wave have to wait on,
+// and how long to wait before checking again. A namespace only counts as settled for the revision
+// it was settled towards, since its target may have changed since it was last reconciled.
+func (r *NamespaceReconciler) waveBlockers(ctx context.Context, wave int) ([]string, time.Duration, error) {
+	var namespaces = &corev1.NamespaceList{}
+	if err := r.List(ctx, namespaces, client.HasLabels{common.WaveLabel}); err != nil {
+		return nil, 0, err
+	}
+	var blocking []string
+	var wait time.Duration
+	var unsettled = false
+	for i := range namespaces.Items {
+		var ns = &namespaces.Items[i]
+		if earlier, ok := namespaceWave(ctx, ns); !ok || earlier >= wave {
+			continue
+		}
+		desiredRev, err := r.getNamespaceDesiredRev(ctx, ns)
+		if err != nil {
+			return nil, 0, err
+		}
+		if desiredRev == "" {
+			continue
+		}
+		// namespaces not seen yet haven't started baking
+		status, ok := r.waves.Get(ns.Name)
+		if !ok || !status.Settled || status.TargetRev != desiredRev {
+			blocking = append(blocking, ns.Name)
+			unsettled = true
+			continue
+		}
+		if baking := status.Baking(r.Config.WaveBakeTime); baking > 0 {
+			blocking = append(blocking, ns.Name)
+			wait = max(wait, baking)
+		}
+	}
+	sort.Strings(blocking)
+
+	if unsettled && (wait == 0 || wait > waveRequeueInterval) {
+		wait = waveRequeueInterval
+	}
+	return blocking, wait, nil
+}
+
+// recordWave records whether the namespace is settled, for namespaces in later waves, and shows
+// its progress on the status board
+func (r *NamespaceReconciler) recordWave(ns *corev1.Namespace, wave int, inWave bool, desiredRev string, settled bool,
+	waitingOn, stuck []string) {
+	if !inWave {
+		r.clearWave(ns.Name)
+		return
+	}
+	r.waves.Record(ns.Name, wave, desiredRev, settled)
+	status, _ := r.waves.Get(ns.Name)
+	var progress = WaveProgress{Wave: wave, Settled: settled, WaitingOn: waitingOn, Stuck: stuck}
+	if settled {
+		progress.SettledSince = &status.Since
+	}
+	r.Status.Set(wavesSection, ns.Name, progress)
+}
+
+// stuckPods returns the outdated pods that won't be restarted, since their controllers can't be
+// restarted, the version policy doesn't allow it, or they were already restarted for the
+// namespace's revision and are still outdated. It also returns true if any other outdated pods
+// are left, which are still to be restarted.
+func (r *NamespaceReconciler) stuckPods(ctx context.Context, pods []metav1.PartialObjectMetadata,
+	run *namespaceRun) ([]string, bool) {
+	var stuck []string
+	var pending = false
+	for _, pod := range pods {
+		if !isOutdatedPod(pod, run.desiredRev) {
+			continue
+		}
+		owner, err := run.finder.FindPodControllerMetadata(ctx, pod)
+		if err != nil {
+			// the pod or its controller is probably being deleted
+			pending = true
+			continue
+		}
+		var key = governor.KeyOf(owner)
+		var _, active = r.governor.Active(key)
+		if run.failed[key] || (!active && r.ledger.RestartedFor(key, run.desiredRev)) {
+			stuck = append(stuck, pod.Name)
+			continue
+		}
+		pending = true
+	}
+	sort.Strings(stuck)
+	return stuck, pending
+}
+
+// clearWave stops tracking the namespace's wave
+func (r *NamespaceReconciler) clearWave(nsName string) {
+	r.waves.Forget(nsName)
+	r.Status.Delete(wavesSection, nsName)
+}
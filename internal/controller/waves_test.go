@@ -0,0 +1,157 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+)
+
+var _ = Describe("Waves", func() {
+	var ctx = context.Background()
+
+	newNamespace := func(name, wave string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+			common.IstioRevLabel: "stable", common.WaveLabel: wave,
+		}}}
+	}
+	newPod := func(ns, name, rev string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns, Name: name, UID: types.UID(ns + "-" + name),
+			Annotations: map[string]string{common.IstioRevLabel: rev},
+		}}
+	}
+	newReconciler := func(objects ...client.Object) *NamespaceReconciler {
+		var tag = &admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{
+			Name: "istio-revision-tag-stable",
+			Labels: map[string]string{
+				"app": webhookAppLabelValue, common.IstioTagLabel: "stable", common.IstioRevLabel: "1-23-0",
+			},
+		}}
+		var revision = &admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{
+			Name:   "istio-sidecar-injector-1-23-0",
+			Labels: map[string]string{"app": webhookAppLabelValue, common.IstioRevLabel: "1-23-0"},
+		}}
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("Pod"), meta.RESTScopeNamespace)
+		c := newFakeClientBuilder().
+			WithRESTMapper(mapper).
+			WithObjects(append(objects, tag, revision)...).
+			Build()
+		r := newFakeReconciler(c, record.NewFakeRecorder(100))
+		r.Config.WaveBakeTime = time.Hour
+		return r
+	}
+
+	It("should wait on earlier namespaces settled before their tag moved", func() {
+		r := newReconciler(
+			newNamespace("first", "1"), newNamespace("second", "2"),
+			newPod("first", "web", "1-22-0"),
+		)
+		// settled and baked long ago, against the old revision
+		r.waves.Record("first", 1, "1-22-0", true)
+
+		blocking, wait, err := r.waveBlockers(ctx, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blocking).To(Equal([]string{"first"}))
+		Expect(wait).To(Equal(waveRequeueInterval))
+	})
+
+	It("should bake earlier namespaces that were settled when first seen", func() {
+		r := newReconciler(
+			newNamespace("first", "1"), newNamespace("second", "2"),
+			newPod("first", "web", "1-23-0"),
+		)
+		blocking, _, err := r.waveBlockers(ctx, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blocking).To(Equal([]string{"first"}))
+
+		r.waves.Record("first", 1, "1-23-0", true)
+		blocking, wait, err := r.waveBlockers(ctx, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blocking).To(Equal([]string{"first"}))
+		Expect(wait).To(BeNumerically(">", 59*time.Minute))
+
+		r.Config.WaveBakeTime = 0
+		blocking, _, err = r.waveBlockers(ctx, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blocking).To(BeEmpty())
+	})
+
+	It("should not wait on later waves or namespaces without a revision", func() {
+		var unlabelled = newNamespace("none", "1")
+		delete(unlabelled.Labels, common.IstioRevLabel)
+		r := newReconciler(
+			unlabelled, newNamespace("second", "2"), newNamespace("third", "3"),
+			newPod("none", "web", "1-22-0"), newPod("third", "web", "1-22-0"),
+		)
+		blocking, wait, err := r.waveBlockers(ctx, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blocking).To(BeEmpty())
+		Expect(wait).To(BeZero())
+	})
+
+	It("should settle namespaces whose only outdated pods won't be restarted, and list them", func() {
+		var first = newNamespace("first", "1")
+		r := newReconciler(first, newNamespace("second", "2"), newPod("first", "bare", "1-22-0"))
+
+		// bare pods aren't restarted without the namespace opting in
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "first"}})
+		Expect(err).NotTo(HaveOccurred())
+		status, ok := r.waves.Get("first")
+		Expect(ok).To(BeTrue())
+		Expect(status.Settled).To(BeTrue())
+		Expect(status.TargetRev).To(Equal("1-23-0"))
+
+		progress, ok := r.Status.Get(wavesSection, "first")
+		Expect(ok).To(BeTrue())
+		Expect(progress.(WaveProgress).Stuck).To(Equal([]string{"bare"}))
+
+		r.Config.WaveBakeTime = 0
+		blocking, _, err := r.waveBlockers(ctx, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blocking).To(BeEmpty())
+	})
+
+	It("should not settle namespaces with outdated pods still to be restarted", func() {
+		var first = newNamespace("first", "1")
+		first.Annotations = map[string]string{common.BarePodDeletionAnnotation: "true"}
+		r := newReconciler(first, newPod("first", "bare", "1-22-0"))
+		r.Config.DryRun = true
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "first"}})
+		Expect(err).NotTo(HaveOccurred())
+		status, _ := r.waves.Get("first")
+		Expect(status.Settled).To(BeFalse())
+		progress, _ := r.Status.Get(wavesSection, "first")
+		Expect(progress.(WaveProgress).Stuck).To(BeEmpty())
+	})
+})
@@ -0,0 +1,87 @@
+package controller
+
+// istiod patches the caBundle of its webhooks regularly, and other tools touch their metadata, so
+// most updates to the webhook configurations don't change which istio revision any namespace
+// should be using. Only the changes that can are worth reconciling namespaces for.
+
+import (
+	"fmt"
+	"sort"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+)
+
+// webhookChanges describes the differences between two versions of a webhook configuration that
+// can change which istio revision namespaces get: the app, tag and revision labels, and each
+// webhook's selectors and injection service. Anything else, like the caBundle, is ignored.
+func webhookChanges(oldConfig, newConfig *admissionregistrationv1.MutatingWebhookConfiguration) []string {
+	var changes []string
+
+	// without the app label, the configuration isn't an istio webhook anymore
+	for _, label := range []string{"app", common.IstioTagLabel, common.IstioRevLabel} {
+		if oldValue, newValue := oldConfig.Labels[label], newConfig.Labels[label]; oldValue != newValue {
+			changes = append(changes, fmt.Sprintf("label %v: %q -> %q", label, oldValue, newValue))
+		}
+	}
+
+	var oldWebhooks = make(map[string]admissionregistrationv1.MutatingWebhook)
+	for _, webhook := range oldConfig.Webhooks {
+		oldWebhooks[webhook.Name] = webhook
+	}
+	for _, newWebhook := range newConfig.Webhooks {
+		oldWebhook, ok := oldWebhooks[newWebhook.Name]
+		delete(oldWebhooks, newWebhook.Name)
+		if !ok {
+			changes = append(changes, fmt.Sprintf("webhook %v added", newWebhook.Name))
+			continue
+		}
+		if !apiequality.Semantic.DeepEqual(oldWebhook.NamespaceSelector, newWebhook.NamespaceSelector) {
+			changes = append(changes, fmt.Sprintf("webhook %v: namespaceSelector changed", newWebhook.Name))
+		}
+		if !apiequality.Semantic.DeepEqual(oldWebhook.ObjectSelector, newWebhook.ObjectSelector) {
+			changes = append(changes, fmt.Sprintf("webhook %v: objectSelector changed", newWebhook.Name))
+		}
+		if !apiequality.Semantic.DeepEqual(oldWebhook.ClientConfig.Service, newWebhook.ClientConfig.Service) {
+			changes = append(changes, fmt.Sprintf("webhook %v: service %v -> %v", newWebhook.Name,
+				describeService(oldWebhook.ClientConfig.Service), describeService(newWebhook.ClientConfig.Service)))
+		}
+		if !apiequality.Semantic.DeepEqual(oldWebhook.ClientConfig.URL, newWebhook.ClientConfig.URL) {
+			changes = append(changes, fmt.Sprintf("webhook %v: url %v -> %v", newWebhook.Name,
+				describeURL(oldWebhook.ClientConfig.URL), describeURL(newWebhook.ClientConfig.URL)))
+		}
+	}
+	var removed []string
+	for name := range oldWebhooks {
+		removed = append(removed, name)
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		changes = append(changes, fmt.Sprintf("webhook %v removed", name))
+	}
+
+	return changes
+}
+
+func describeService(service *admissionregistrationv1.ServiceReference) string {
+	if service == nil {
+		return "none"
+	}
+	var description = service.Namespace + "/" + service.Name
+	if service.Path != nil {
+		description += *service.Path
+	}
+	if service.Port != nil {
+		description += fmt.Sprintf(":%d", *service.Port)
+	}
+	return description
+}
+
+func describeURL(url *string) string {
+	if url == nil {
+		return "none"
+	}
+	return *url
+}
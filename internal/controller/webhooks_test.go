@@ -0,0 +1,156 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+)
+
+var _ = Describe("Webhook changes", func() {
+	newWebhookConfig := func() *admissionregistrationv1.MutatingWebhookConfiguration {
+		return &admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "istio-revision-tag-stable",
+				Labels: map[string]string{
+					"app":                webhookAppLabelValue,
+					common.IstioTagLabel: "stable",
+					common.IstioRevLabel: "1-22-0",
+				},
+			},
+			Webhooks: []admissionregistrationv1.MutatingWebhook{{
+				Name: "namespace.sidecar-injector.istio.io",
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{
+					Service:  &admissionregistrationv1.ServiceReference{Namespace: "istio-system", Name: "istiod-1-22-0"},
+					CABundle: []byte("old"),
+				},
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{common.IstioRevLabel: "stable"}},
+			}},
+		}
+	}
+
+	It("should ignore caBundle rotation and metadata changes", func() {
+		oldConfig, newConfig := newWebhookConfig(), newWebhookConfig()
+		newConfig.Webhooks[0].ClientConfig.CABundle = []byte("new")
+		newConfig.Annotations = map[string]string{"touched": "true"}
+		newConfig.ResourceVersion = "2"
+		Expect(webhookChanges(oldConfig, newConfig)).To(BeEmpty())
+	})
+
+	It("should notice the tag pointing to another revision", func() {
+		oldConfig, newConfig := newWebhookConfig(), newWebhookConfig()
+		newConfig.Labels[common.IstioRevLabel] = "1-23-0"
+		newConfig.Webhooks[0].ClientConfig.Service.Name = "istiod-1-23-0"
+		Expect(webhookChanges(oldConfig, newConfig)).To(ConsistOf(
+			ContainSubstring("label istio.io/rev"),
+			ContainSubstring("istio-system/istiod-1-22-0 -> istio-system/istiod-1-23-0"),
+		))
+	})
+
+	It("should notice selector changes and removed webhooks", func() {
+		oldConfig, newConfig := newWebhookConfig(), newWebhookConfig()
+		newConfig.Webhooks[0].NamespaceSelector.MatchLabels[common.IstioRevLabel] = "canary"
+		Expect(webhookChanges(oldConfig, newConfig)).To(ConsistOf(ContainSubstring("namespaceSelector")))
+
+		newConfig.Webhooks = nil
+		Expect(webhookChanges(oldConfig, newConfig)).To(ConsistOf(ContainSubstring("removed")))
+	})
+
+	It("should list removed webhooks in a stable order", func() {
+		oldConfig, newConfig := newWebhookConfig(), newWebhookConfig()
+		for _, name := range []string{"c.sidecar-injector.istio.io", "a.sidecar-injector.istio.io", "b.sidecar-injector.istio.io"} {
+			var webhook = oldConfig.Webhooks[0].DeepCopy()
+			webhook.Name = name
+			oldConfig.Webhooks = append(oldConfig.Webhooks, *webhook)
+		}
+		Expect(webhookChanges(oldConfig, newConfig)).To(Equal([]string{
+			"webhook a.sidecar-injector.istio.io removed",
+			"webhook b.sidecar-injector.istio.io removed",
+			"webhook c.sidecar-injector.istio.io removed",
+		}))
+	})
+
+	It("should notice the app label being removed", func() {
+		oldConfig, newConfig := newWebhookConfig(), newWebhookConfig()
+		delete(newConfig.Labels, "app")
+		Expect(webhookChanges(oldConfig, newConfig)).To(ConsistOf(ContainSubstring("label app")))
+	})
+})
+
+var _ = Describe("Webhook events", func() {
+	var ctx = context.Background()
+
+	var r *NamespaceReconciler
+	var queue workqueue.TypedRateLimitingInterface[reconcile.Request]
+	var webhook *admissionregistrationv1.MutatingWebhookConfiguration
+
+	newNamespace := func(name, label string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{common.IstioRevLabel: label}}}
+	}
+
+	enqueued := func() []string {
+		var names []string
+		for queue.Len() > 0 {
+			req, _ := queue.Get()
+			names = append(names, req.Name)
+			queue.Done(req)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		r = &NamespaceReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			newNamespace("app-1", "stable"), newNamespace("app-2", "stable"), newNamespace("canary", "canary"),
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "plain"}},
+		).Build()}
+		webhook = &admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{
+			Name: "istio-revision-tag-stable",
+			Labels: map[string]string{
+				"app": webhookAppLabelValue, common.IstioTagLabel: "stable", common.IstioRevLabel: "1-22-0",
+			},
+		}}
+		queue = workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+		DeferCleanup(queue.ShutDown)
+	})
+
+	It("should enqueue the namespaces using a deleted webhook's tag", func() {
+		r.webhookEventHandlers().Delete(ctx,
+			event.TypedDeleteEvent[*admissionregistrationv1.MutatingWebhookConfiguration]{Object: webhook}, queue)
+		Expect(enqueued()).To(ConsistOf("app-1", "app-2"))
+	})
+
+	It("should enqueue the namespaces using a webhook's tag when it loses its app label", func() {
+		var updated = webhook.DeepCopy()
+		delete(updated.Labels, "app")
+		r.webhookEventHandlers().Update(ctx,
+			event.TypedUpdateEvent[*admissionregistrationv1.MutatingWebhookConfiguration]{ObjectOld: webhook, ObjectNew: updated}, queue)
+		Expect(enqueued()).To(ConsistOf("app-1", "app-2"))
+	})
+})
@@ -0,0 +1,261 @@
+package governor
+
+// Moving an istio tag from one revision to another outdates the sidecars of every workload in
+// the namespaces using the tag. Each namespace is reconciled on its own, but the move is tracked
+// as one campaign, so its progress can be followed as a whole.
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WorkloadState is where a workload is at in a campaign
+type WorkloadState string
+
+const (
+	// WorkloadPending has outdated pods and hasn't been restarted yet
+	WorkloadPending WorkloadState = "Pending"
+	// WorkloadInProgress is being restarted
+	WorkloadInProgress WorkloadState = "InProgress"
+	// WorkloadDone has no outdated pods left
+	WorkloadDone WorkloadState = "Done"
+	// WorkloadFailed still has outdated pods, and won't be restarted again for the campaign
+	WorkloadFailed WorkloadState = "Failed"
+)
+
+// outcomes of campaigns that have ended
+const (
+	CampaignCompleted  = "Completed"
+	CampaignSuperseded = "Superseded"
+)
+
+// how many ended campaigns are kept around to report on
+const maxEndedCampaigns = 10
+
+// Campaign is the move of an istio tag from one revision to another
+type Campaign struct {
+	ID        string `json:"id"`
+	Tag       string `json:"tag"`
+	SourceRev string `json:"sourceRev"`
+	TargetRev string `json:"targetRev"`
+
+	// name of the tag's webhook configuration
+	Webhook string `json:"webhook"`
+
+	Started time.Time  `json:"started"`
+	Ended   *time.Time `json:"ended,omitempty"`
+	Outcome string     `json:"outcome,omitempty"`
+
+	// workloads in each state
+	Pending    int `json:"pending"`
+	InProgress int `json:"inProgress"`
+	Done       int `json:"done"`
+	Failed     int `json:"failed"`
+
+	// when the pending and in progress workloads should be done, at the current restart rate
+	ETA *time.Time `json:"eta,omitempty"`
+}
+
+type campaignProgress struct {
+	Campaign
+
+	// namespaces using the tag, and whether they've been reconciled since the campaign started
+	namespaces map[string]bool
+	workloads  map[ControllerKey]WorkloadState
+}
+
+// Campaigns tracks the campaigns under way, and the last few that ended. It is safe for
+// concurrent use.
+type Campaigns struct {
+	mu                sync.Mutex
+	restartsPerMinute float32
+	campaigns         map[string]*campaignProgress
+
+	// ID of the campaign under way for each tag
+	active map[string]string
+}
+
+// NewCampaigns returns a Campaigns working out ETAs from the given restart rate, or from the rate
+// restarts have been finishing at if it's zero or less
+func NewCampaigns(restartsPerMinute float32) *Campaigns {
+	return &Campaigns{
+		restartsPerMinute: restartsPerMinute,
+		campaigns:         make(map[string]*campaignProgress),
+		active:            make(map[string]string),
+	}
+}
+
+// Start starts a campaign moving a tag between revisions, across the given namespaces. A campaign
+// already under way for the tag is ended as superseded, and returned along with the new one. With
+// no namespaces there's nothing to wait on, so the new campaign is completed right away.
+func (c *Campaigns) Start(tag, sourceRev, targetRev, webhook string, namespaces []string) (Campaign, *Campaign) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var now = time.Now()
+	var superseded *Campaign
+	if id, ok := c.active[tag]; ok {
+		var old = c.campaigns[id]
+		c.end(old, CampaignSuperseded, now)
+		var ended = old.Campaign
+		superseded = &ended
+	}
+
+	var progress = &campaignProgress{
+		Campaign: Campaign{
+			ID:        fmt.Sprintf("%v-%v-to-%v-%d", tag, sourceRev, targetRev, now.Unix()),
+			Tag:       tag,
+			SourceRev: sourceRev,
+			TargetRev: targetRev,
+			Webhook:   webhook,
+			Started:   now,
+		},
+		namespaces: make(map[string]bool, len(namespaces)),
+		workloads:  make(map[ControllerKey]WorkloadState),
+	}
+	for _, ns := range namespaces {
+		progress.namespaces[ns] = false
+	}
+	c.campaigns[progress.ID] = progress
+	c.active[tag] = progress.ID
+	c.update(progress, now)
+	c.prune()
+	return progress.Campaign, superseded
+}
+
+// ActiveFor returns the campaign under way for the tag, if there is one
+func (c *Campaigns) ActiveFor(tag string) (Campaign, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, ok := c.active[tag]
+	if !ok {
+		return Campaign{}, false
+	}
+	return c.campaigns[id].Campaign, true
+}
+
+// Observe records the state of the outdated workloads in a namespace, as of its last reconcile.
+// Workloads of the namespace seen before that aren't outdated anymore are done. It returns the
+// campaign, and true if this ended it.
+func (c *Campaigns) Observe(id, namespace string, outdated map[ControllerKey]WorkloadState) (Campaign, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var progress, ok = c.campaigns[id]
+	if !ok || progress.Ended != nil {
+		return Campaign{}, false
+	}
+
+	for key := range progress.workloads {
+		if _, still := outdated[key]; key.Namespace == namespace && !still {
+			progress.workloads[key] = WorkloadDone
+		}
+	}
+	for key, state := range outdated {
+		progress.workloads[key] = state
+	}
+	progress.namespaces[namespace] = true
+	return c.update(progress, time.Now())
+}
+
+// ForgetNamespace stops waiting on a namespace that's gone
+func (c *Campaigns) ForgetNamespace(namespace string) []Campaign {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var ended []Campaign
+	for _, id := range c.active {
+		var progress = c.campaigns[id]
+		if _, ok := progress.namespaces[namespace]; !ok {
+			continue
+		}
+		delete(progress.namespaces, namespace)
+		for key := range progress.workloads {
+			if key.Namespace == namespace {
+				delete(progress.workloads, key)
+			}
+		}
+		if campaign, done := c.update(progress, time.Now()); done {
+			ended = append(ended, campaign)
+		}
+	}
+	return ended
+}
+
+// List returns the campaigns under way and the last few that ended, oldest first
+func (c *Campaigns) List() []Campaign {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var campaigns = make([]Campaign, 0, len(c.campaigns))
+	for _, progress := range c.campaigns {
+		campaigns = append(campaigns, progress.Campaign)
+	}
+	sort.Slice(campaigns, func(i, j int) bool { return campaigns[i].Started.Before(campaigns[j].Started) })
+	return campaigns
+}
+
+// update recounts the campaign's workloads and works out its ETA, ending it if every namespace
+// has been reconciled and no workloads are left to restart
+func (c *Campaigns) update(progress *campaignProgress, now time.Time) (Campaign, bool) {
+	var counts = make(map[WorkloadState]int)
+	for _, state := range progress.workloads {
+		counts[state]++
+	}
+	progress.Pending = counts[WorkloadPending]
+	progress.InProgress = counts[WorkloadInProgress]
+	progress.Done = counts[WorkloadDone]
+	progress.Failed = counts[WorkloadFailed]
+
+	var remaining = progress.Pending + progress.InProgress
+	var reconciled = true
+	for _, seen := range progress.namespaces {
+		reconciled = reconciled && seen
+	}
+	if remaining == 0 && reconciled {
+		c.end(progress, CampaignCompleted, now)
+		return progress.Campaign, true
+	}
+
+	// once workloads have been seen to finish, the rate they finish at is the best guide, since it
+	// reflects the active restart limit and how long rollouts take. Until then the rate limit is
+	// all there is to go on.
+	progress.ETA = nil
+	var perMinute = float64(c.restartsPerMinute)
+	if elapsed := now.Sub(progress.Started).Minutes(); progress.Done > 0 && elapsed > 0 {
+		perMinute = float64(progress.Done) / elapsed
+	}
+	if perMinute > 0 && remaining > 0 {
+		var eta = now.Add(time.Duration(float64(remaining) / perMinute * float64(time.Minute)))
+		progress.ETA = &eta
+	}
+	return progress.Campaign, false
+}
+
+// end ends the campaign with the given outcome
+func (c *Campaigns) end(progress *campaignProgress, outcome string, now time.Time) {
+	progress.Ended = &now
+	progress.Outcome = outcome
+	progress.ETA = nil
+	if c.active[progress.Tag] == progress.ID {
+		delete(c.active, progress.Tag)
+	}
+}
+
+// prune drops the oldest ended campaigns beyond the few kept around
+func (c *Campaigns) prune() {
+	var ended []*campaignProgress
+	for _, progress := range c.campaigns {
+		if progress.Ended != nil {
+			ended = append(ended, progress)
+		}
+	}
+	if len(ended) <= maxEndedCampaigns {
+		return
+	}
+	sort.Slice(ended, func(i, j int) bool { return ended[i].Ended.Before(*ended[j].Ended) })
+	for _, progress := range ended[:len(ended)-maxEndedCampaigns] {
+		delete(c.campaigns, progress.ID)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package governor
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Campaigns", func() {
+	key := func(ns, name string) ControllerKey {
+		return ControllerKey{
+			GroupKind:      schema.GroupKind{Group: "apps", Kind: "Deployment"},
+			NamespacedName: types.NamespacedName{Namespace: ns, Name: name},
+		}
+	}
+
+	It("should track workloads until every namespace is done", func() {
+		c := NewCampaigns(6)
+		campaign, superseded := c.Start("stable", "1-22-0", "1-23-0", "istio-revision-tag-stable", []string{"a", "b"})
+		Expect(superseded).To(BeNil())
+
+		campaign, ended := c.Observe(campaign.ID, "a", map[ControllerKey]WorkloadState{
+			key("a", "one"): WorkloadInProgress,
+			key("a", "two"): WorkloadPending,
+		})
+		Expect(ended).To(BeFalse())
+		Expect(campaign.Pending).To(Equal(1))
+		Expect(campaign.InProgress).To(Equal(1))
+		// two workloads left at six restarts a minute
+		Expect(campaign.ETA).NotTo(BeNil())
+		Expect(campaign.ETA.Sub(campaign.Started).Seconds()).To(BeNumerically("~", 20, 1))
+
+		// workloads no longer outdated are done
+		campaign, ended = c.Observe(campaign.ID, "a", map[ControllerKey]WorkloadState{key("a", "two"): WorkloadFailed})
+		Expect(ended).To(BeFalse())
+		Expect(campaign.Done).To(Equal(1))
+		Expect(campaign.Failed).To(Equal(1))
+
+		// namespace b hasn't been reconciled yet
+		campaign, ended = c.Observe(campaign.ID, "b", nil)
+		Expect(ended).To(BeTrue())
+		Expect(campaign.Outcome).To(Equal(CampaignCompleted))
+		_, ok := c.ActiveFor("stable")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should complete a campaign without namespaces right away", func() {
+		c := NewCampaigns(6)
+		campaign, _ := c.Start("unused", "1-22-0", "1-23-0", "istio-revision-tag-unused", nil)
+		Expect(campaign.Ended).NotTo(BeNil())
+		Expect(campaign.Outcome).To(Equal(CampaignCompleted))
+		_, ok := c.ActiveFor("unused")
+		Expect(ok).To(BeFalse())
+		Expect(c.List()).To(ConsistOf(campaign))
+	})
+
+	It("should work out the ETA from the rate workloads finish at, once any have", func() {
+		c := NewCampaigns(60)
+		campaign, _ := c.Start("stable", "1-22-0", "1-23-0", "istio-revision-tag-stable", []string{"a"})
+		progress := c.campaigns[campaign.ID]
+		for _, name := range []string{"one", "two", "three", "four"} {
+			progress.workloads[key("a", name)] = WorkloadPending
+		}
+		progress.workloads[key("a", "done")] = WorkloadDone
+
+		// one workload done in ten minutes leaves four to go at one every ten minutes, however
+		// fast the rate limit would allow
+		updated, ended := c.update(progress, campaign.Started.Add(10*time.Minute))
+		Expect(ended).To(BeFalse())
+		Expect(updated.ETA).NotTo(BeNil())
+		Expect(updated.ETA.Sub(campaign.Started)).To(Equal(50 * time.Minute))
+	})
+
+	It("should supersede the campaign of a tag that moves again", func() {
+		c := NewCampaigns(0)
+		first, _ := c.Start("stable", "1-22-0", "1-23-0", "istio-revision-tag-stable", []string{"a"})
+		second, superseded := c.Start("stable", "1-23-0", "1-22-0", "istio-revision-tag-stable", []string{"a"})
+		Expect(superseded).NotTo(BeNil())
+		Expect(superseded.ID).To(Equal(first.ID))
+		Expect(superseded.Outcome).To(Equal(CampaignSuperseded))
+
+		active, ok := c.ActiveFor("stable")
+		Expect(ok).To(BeTrue())
+		Expect(active.ID).To(Equal(second.ID))
+		Expect(c.List()).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,240 @@
+// Package governor paces restarts across every namespace being reconciled. Namespaces can be
+// reconciled in parallel, so the limits on how fast controllers get restarted, and on how many
+// may be rolling out at once, have to be shared between reconciles, as does the knowledge of which
+// controllers a reconcile is already working on.
+package governor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ControllerKey identifies a pod controller. The API version is left out, since the same object
+// can be read through more than one version.
+type ControllerKey struct {
+	schema.GroupKind
+	types.NamespacedName
+}
+
+func (k ControllerKey) String() string {
+	return fmt.Sprintf("%v/%v", k.GroupKind, k.NamespacedName)
+}
+
+// KeyOf returns the key of the given controller, which must have its GVK set
+func KeyOf(obj ctrlclient.Object) ControllerKey {
+	return ControllerKey{
+		GroupKind:      obj.GetObjectKind().GroupVersionKind().GroupKind(),
+		NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()},
+	}
+}
+
+// ActiveRestart is a restart that's started and hasn't been seen to finish yet
+type ActiveRestart struct {
+	// GVK the controller was restarted through
+	GVK schema.GroupVersionKind
+
+	// the restart is done in steps by the restarter, rather than rolled out by the controller
+	Stepwise bool
+
+	Started time.Time
+}
+
+// Governor holds the restart budget and the controller claims shared by all reconciles. It is
+// safe for concurrent use.
+type Governor struct {
+	mu          sync.Mutex
+	limiter     *rate.Limiter
+	activeLimit int
+	active      map[ControllerKey]ActiveRestart
+	claims      map[ControllerKey]bool
+
+	// namespaces with restarts waiting that should go ahead of all others
+	priority map[string]bool
+}
+
+// New returns a Governor allowing restartsPerMinute new restarts a minute, and no more than
+// activeLimit restarts active at once. Zero or less means no limit.
+func New(restartsPerMinute float32, activeLimit int) *Governor {
+	var limiter = rate.NewLimiter(rate.Inf, 0)
+	if restartsPerMinute > 0 {
+		limiter = rate.NewLimiter(rate.Limit(restartsPerMinute/60), max(activeLimit, 1))
+	}
+	return &Governor{
+		limiter:     limiter,
+		activeLimit: activeLimit,
+		active:      make(map[ControllerKey]ActiveRestart),
+		claims:      make(map[ControllerKey]bool),
+		priority:    make(map[string]bool),
+	}
+}
+
+// TryStart reserves budget for restarting the controller, and marks its restart as active. It
+// returns false if there's no budget right now, along with how long to wait before trying again,
+// or zero if it's waiting on active restarts to finish. Restarts that are already active don't need
+// more budget, so stepwise restarts only use it up once. Restarts that aren't priority ones wait
+// while priority restarts are waiting anywhere.
+func (g *Governor) TryStart(key ControllerKey, gvk schema.GroupVersionKind, priority bool) (bool, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.active[key]; ok {
+		return true, 0
+	}
+	if !priority && len(g.priority) > 0 {
+		return false, 0
+	}
+	if g.activeLimit > 0 && len(g.active) >= g.activeLimit {
+		return false, 0
+	}
+	var reservation = g.limiter.Reserve()
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+		return false, delay
+	}
+	g.active[key] = ActiveRestart{GVK: gvk, Started: time.Now()}
+	return true, 0
+}
+
+// ForceStart marks the controller's restart as active without waiting for budget or for other
+// restarts to finish, for restarts too urgent to be paced. It still counts against the limits of
+// other restarts while it's active.
+func (g *Governor) ForceStart(key ControllerKey, gvk schema.GroupVersionKind) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.active[key]; !ok {
+		g.active[key] = ActiveRestart{GVK: gvk, Started: time.Now()}
+	}
+}
+
+// SetStepwise records whether the controller's active restart is being done in steps
+func (g *Governor) SetStepwise(key ControllerKey, stepwise bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if restart, ok := g.active[key]; ok {
+		restart.Stepwise = stepwise
+		g.active[key] = restart
+	}
+}
+
+// Finish marks the controller's restart as done, freeing its place among the active restarts
+func (g *Governor) Finish(key ControllerKey) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.active, key)
+}
+
+// Active returns the controller's active restart, if it has one
+func (g *Governor) Active(key ControllerKey) (ActiveRestart, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	restart, ok := g.active[key]
+	return restart, ok
+}
+
+// ActiveIn returns the active restarts of controllers in the namespace
+func (g *Governor) ActiveIn(namespace string) map[ControllerKey]ActiveRestart {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var restarts = make(map[ControllerKey]ActiveRestart)
+	for key, restart := range g.active {
+		if key.Namespace == namespace {
+			restarts[key] = restart
+		}
+	}
+	return restarts
+}
+
+// SetPriorityPending records whether the namespace has priority restarts waiting to start
+func (g *Governor) SetPriorityPending(namespace string, pending bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if pending {
+		g.priority[namespace] = true
+	} else {
+		delete(g.priority, namespace)
+	}
+}
+
+// FinishNamespace forgets every active restart in the namespace, for when it's gone
+func (g *Governor) FinishNamespace(namespace string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.priority, namespace)
+	for key := range g.active {
+		if key.Namespace == namespace {
+			delete(g.active, key)
+		}
+	}
+}
+
+// NewSession returns a Session for one reconcile to claim controllers through
+func (g *Governor) NewSession() *Session {
+	return &Session{governor: g, keys: make(map[ControllerKey]bool)}
+}
+
+// Session holds the controllers claimed by one reconcile, so no two reconciles work on the same
+// controller at once. It isn't safe for concurrent use, and must be released when the reconcile
+// is done.
+type Session struct {
+	governor *Governor
+	keys     map[ControllerKey]bool
+}
+
+// Holds returns true if this session has already claimed the controller
+func (s *Session) Holds(key ControllerKey) bool {
+	return s.keys[key]
+}
+
+// Claim claims the controller for this session. It returns false if another session holds it.
+func (s *Session) Claim(key ControllerKey) bool {
+	if s.keys[key] {
+		return true
+	}
+	s.governor.mu.Lock()
+	defer s.governor.mu.Unlock()
+	if s.governor.claims[key] {
+		return false
+	}
+	s.governor.claims[key] = true
+	s.keys[key] = true
+	return true
+}
+
+// Release gives up every claim held by this session
+func (s *Session) Release() {
+	s.governor.mu.Lock()
+	defer s.governor.mu.Unlock()
+	for key := range s.keys {
+		delete(s.governor.claims, key)
+	}
+	s.keys = make(map[ControllerKey]bool)
+}
+
+// Snapshot returns a copy of the active restarts
+func (g *Governor) Snapshot() map[ControllerKey]ActiveRestart {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var active = make(map[ControllerKey]ActiveRestart, len(g.active))
+	for key, restart := range g.active {
+		active[key] = restart
+	}
+	return active
+}
+
+// Restore adds active restarts from a snapshot, such as one saved by a previous leader. Restarts
+// already active are kept.
+func (g *Governor) Restore(active map[ControllerKey]ActiveRestart) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for key, restart := range active {
+		if _, ok := g.active[key]; !ok {
+			g.active[key] = restart
+		}
+	}
+}
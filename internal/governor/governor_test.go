@@ -0,0 +1,241 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package governor
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Governor", func() {
+	var gvk = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	key := func(ns, name string) ControllerKey {
+		return ControllerKey{GroupKind: gvk.GroupKind(), NamespacedName: types.NamespacedName{Namespace: ns, Name: name}}
+	}
+
+	It("should limit the number of active restarts", func() {
+		g := New(0, 2)
+		Expect(g.TryStart(key("a", "one"), gvk, false)).To(BeTrue())
+		Expect(g.TryStart(key("b", "two"), gvk, false)).To(BeTrue())
+		started, _ := g.TryStart(key("a", "three"), gvk, false)
+		Expect(started).To(BeFalse())
+
+		// restarts already active don't need more room
+		started, _ = g.TryStart(key("a", "one"), gvk, false)
+		Expect(started).To(BeTrue())
+
+		g.Finish(key("a", "one"))
+		started, _ = g.TryStart(key("a", "three"), gvk, false)
+		Expect(started).To(BeTrue())
+		Expect(g.ActiveIn("a")).To(HaveLen(1))
+
+		g.FinishNamespace("b")
+		Expect(g.ActiveIn("b")).To(BeEmpty())
+	})
+
+	It("should limit the rate of new restarts", func() {
+		g := New(1, 1)
+		started, _ := g.TryStart(key("a", "one"), gvk, false)
+		Expect(started).To(BeTrue())
+		g.Finish(key("a", "one"))
+
+		started, retryAfter := g.TryStart(key("a", "two"), gvk, false)
+		Expect(started).To(BeFalse())
+		Expect(retryAfter).To(BeNumerically(">", 0))
+	})
+
+	It("should hold back other restarts while priority ones are waiting", func() {
+		g := New(0, 0)
+		g.SetPriorityPending("a", true)
+		started, _ := g.TryStart(key("b", "two"), gvk, false)
+		Expect(started).To(BeFalse())
+		Expect(g.TryStart(key("a", "one"), gvk, true)).To(BeTrue())
+
+		g.SetPriorityPending("a", false)
+		Expect(g.TryStart(key("b", "two"), gvk, false)).To(BeTrue())
+	})
+
+	It("should let only one session claim a controller", func() {
+		g := New(0, 0)
+		first, second := g.NewSession(), g.NewSession()
+
+		Expect(first.Claim(key("a", "one"))).To(BeTrue())
+		Expect(first.Holds(key("a", "one"))).To(BeTrue())
+		Expect(second.Claim(key("a", "one"))).To(BeFalse())
+		Expect(second.Holds(key("a", "one"))).To(BeFalse())
+
+		first.Release()
+		Expect(second.Claim(key("a", "one"))).To(BeTrue())
+	})
+})
+
+var _ = Describe("Ledger", func() {
+	var key = ControllerKey{
+		GroupKind:      schema.GroupKind{Group: "apps", Kind: "StatefulSet"},
+		NamespacedName: types.NamespacedName{Namespace: "a", Name: "db"},
+	}
+
+	It("should only count a restart once every step is done", func() {
+		l := NewLedger()
+		Expect(l.RestartedFor(key, "1-23-0")).To(BeFalse())
+
+		l.Record(key, "1-23-0", true)
+		Expect(l.RestartedFor(key, "1-23-0")).To(BeFalse())
+		first, _ := l.Get(key)
+
+		l.Record(key, "1-23-0", false)
+		Expect(l.RestartedFor(key, "1-23-0")).To(BeTrue())
+		last, _ := l.Get(key)
+		Expect(last.RestartedAt).To(Equal(first.RestartedAt))
+	})
+
+	It("should keep controllers of different kinds apart", func() {
+		l := NewLedger()
+		l.Record(key, "1-23-0", false)
+
+		other := key
+		other.Kind = "Deployment"
+		Expect(l.RestartedFor(other, "1-23-0")).To(BeFalse())
+	})
+
+	It("should allow another restart once the revision changes", func() {
+		l := NewLedger()
+		l.Record(key, "1-23-0", false)
+		Expect(l.RestartedFor(key, "1-24-0")).To(BeFalse())
+
+		l.ForgetNamespace("a")
+		_, ok := l.Get(key)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should drop a namespace's entries when its target changes, even back to an earlier one", func() {
+		l := NewLedger()
+		_, changed := l.Retarget("a", "1-23-0")
+		Expect(changed).To(BeFalse())
+		l.Record(key, "1-23-0", false)
+
+		previous, changed := l.Retarget("a", "1-24-0")
+		Expect(changed).To(BeTrue())
+		Expect(previous).To(Equal("1-23-0"))
+
+		// rolled back before the controller was restarted for 1-24-0
+		_, changed = l.Retarget("a", "1-23-0")
+		Expect(changed).To(BeTrue())
+		Expect(l.RestartedFor(key, "1-23-0")).To(BeFalse())
+	})
+})
+
+var _ = Describe("Store", func() {
+	var ctx = context.Background()
+	var gvk = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	var key = ControllerKey{GroupKind: gvk.GroupKind(), NamespacedName: types.NamespacedName{Namespace: "a", Name: "web"}}
+
+	It("should hand the state over to the next leader", func() {
+		client := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+		g, l := New(0, 0), NewLedger()
+		store := NewStore(client, client, "fortsa", "state")
+		Expect(store.Load(ctx, g, l)).To(Succeed())
+		Expect(g.TryStart(key, gvk, false)).To(BeTrue())
+		l.Retarget("a", "1-23-0")
+		l.Record(key, "1-23-0", false)
+		Expect(store.Save(ctx, g, l)).To(Succeed())
+
+		next, nextLedger := New(0, 0), NewLedger()
+		Expect(NewStore(client, client, "fortsa", "state").Load(ctx, next, nextLedger)).To(Succeed())
+		active, ok := next.Active(key)
+		Expect(ok).To(BeTrue())
+		Expect(active.GVK).To(Equal(gvk))
+		Expect(nextLedger.RestartedFor(key, "1-23-0")).To(BeTrue())
+		Expect(nextLedger.Targets()).To(Equal(map[string]string{"a": "1-23-0"}))
+	})
+
+	It("should not save anything before loading", func() {
+		client := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		Expect(NewStore(client, client, "fortsa", "state").Save(ctx, New(0, 0), NewLedger())).To(Succeed())
+
+		var cm = &corev1.ConfigMap{}
+		err := client.Get(ctx, types.NamespacedName{Namespace: "fortsa", Name: "state"}, cm)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Waves", func() {
+	It("should start baking namespaces once they've settled", func() {
+		w := NewWaves()
+		w.Record("first", 1, "1-23-0", false)
+		status, ok := w.Get("first")
+		Expect(ok).To(BeTrue())
+		Expect(status.Settled).To(BeFalse())
+
+		w.Record("first", 1, "1-23-0", true)
+		status, _ = w.Get("first")
+		Expect(status.Settled).To(BeTrue())
+		Expect(status.Baking(time.Hour)).To(BeNumerically(">", 59*time.Minute))
+		Expect(status.Baking(0)).To(BeZero())
+	})
+
+	It("should bake namespaces that were already settled when first seen", func() {
+		w := NewWaves()
+		w.Record("first", 1, "1-23-0", true)
+		status, _ := w.Get("first")
+		Expect(status.Settled).To(BeTrue())
+		Expect(status.Baking(time.Hour)).To(BeNumerically(">", 59*time.Minute))
+	})
+
+	It("should keep the bake clock running while namespaces stay settled", func() {
+		w := NewWaves()
+		w.Record("first", 1, "1-23-0", true)
+		since := time.Now().Add(-2 * time.Hour)
+		w.namespaces["first"] = WaveStatus{Wave: 1, TargetRev: "1-23-0", Settled: true, Since: since}
+
+		w.Record("first", 1, "1-23-0", true)
+		status, _ := w.Get("first")
+		Expect(status.Since).To(Equal(since))
+		Expect(status.Baking(time.Hour)).To(BeZero())
+
+		// settling again towards another revision starts the bake over
+		w.Record("first", 1, "1-24-0", true)
+		status, _ = w.Get("first")
+		Expect(status.TargetRev).To(Equal("1-24-0"))
+		Expect(status.Baking(time.Hour)).To(BeNumerically(">", 59*time.Minute))
+	})
+
+	It("should unsettle namespaces whose target changed", func() {
+		w := NewWaves()
+		w.namespaces["first"] = WaveStatus{Wave: 1, Settled: true, Since: time.Now().Add(-2 * time.Hour)}
+
+		w.Unsettle("first")
+		status, _ := w.Get("first")
+		Expect(status.Wave).To(Equal(1))
+		Expect(status.Settled).To(BeFalse())
+
+		w.Unsettle("unknown")
+		_, ok := w.Get("unknown")
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,163 @@
+package governor
+
+// The ledger remembers which istio revision each controller was last restarted for. Reconciles
+// come and go, but a controller whose pods are still outdated after we restarted it for the
+// namespace's current revision won't be fixed by restarting it again, so it's only restarted
+// again once the namespace moves to another revision. When it does, even back to a revision it
+// used before, the namespace's entries are dropped, so none of them hold up restarts for the new
+// revision.
+
+import (
+	"sync"
+	"time"
+)
+
+// LedgerEntry records the last restart of a controller
+type LedgerEntry struct {
+	// the istio revision the controller was restarted for
+	TargetRev string
+
+	// when the restart started
+	RestartedAt time.Time
+
+	// the restart is being done in steps, and more steps remain
+	Stepwise bool
+}
+
+// Ledger holds the last restart of each controller, keyed by its group, kind, namespace and name.
+// It is safe for concurrent use.
+type Ledger struct {
+	mu      sync.Mutex
+	entries map[ControllerKey]LedgerEntry
+
+	// istio revision each namespace's pods were last restarted towards
+	targets map[string]string
+}
+
+// NewLedger returns an empty ledger
+func NewLedger() *Ledger {
+	return &Ledger{entries: make(map[ControllerKey]LedgerEntry), targets: make(map[string]string)}
+}
+
+// Retarget records the istio revision the namespace's pods should use. If that's changed since it
+// was last recorded, the namespace's entries are dropped, since they were for an earlier target,
+// and the previous target is returned along with true.
+func (l *Ledger) Retarget(namespace, targetRev string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	previous, ok := l.targets[namespace]
+	l.targets[namespace] = targetRev
+	if !ok || previous == targetRev {
+		return previous, false
+	}
+	for key := range l.entries {
+		if key.Namespace == namespace {
+			delete(l.entries, key)
+		}
+	}
+	return previous, true
+}
+
+// Get returns the controller's entry, if it has one
+func (l *Ledger) Get(key ControllerKey) (LedgerEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.entries[key]
+	return entry, ok
+}
+
+// RestartedFor returns true if the controller has already been restarted for the revision, and
+// there are no steps of that restart left to take
+func (l *Ledger) RestartedFor(key ControllerKey, targetRev string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.entries[key]
+	return ok && entry.TargetRev == targetRev && !entry.Stepwise
+}
+
+// Record records a restart of the controller for the revision. Further steps of a restart for the
+// same revision keep its original restart time.
+func (l *Ledger) Record(key ControllerKey, targetRev string, stepwise bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.entries[key]
+	if !ok || entry.TargetRev != targetRev {
+		entry = LedgerEntry{TargetRev: targetRev, RestartedAt: time.Now()}
+	}
+	entry.Stepwise = stepwise
+	l.entries[key] = entry
+}
+
+// FinishSteps records that no steps are left of the controller's last restart
+func (l *Ledger) FinishSteps(key ControllerKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if entry, ok := l.entries[key]; ok {
+		entry.Stepwise = false
+		l.entries[key] = entry
+	}
+}
+
+// Forget removes the controller's entry
+func (l *Ledger) Forget(key ControllerKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// ForgetNamespace removes the entries of every controller in the namespace, for when it's gone
+func (l *Ledger) ForgetNamespace(namespace string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.targets, namespace)
+	for key := range l.entries {
+		if key.Namespace == namespace {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// Snapshot returns a copy of the ledger's entries
+func (l *Ledger) Snapshot() map[ControllerKey]LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var entries = make(map[ControllerKey]LedgerEntry, len(l.entries))
+	for key, entry := range l.entries {
+		entries[key] = entry
+	}
+	return entries
+}
+
+// Targets returns a copy of the revisions namespaces were last restarted towards
+func (l *Ledger) Targets() map[string]string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var targets = make(map[string]string, len(l.targets))
+	for namespace, rev := range l.targets {
+		targets[namespace] = rev
+	}
+	return targets
+}
+
+// RestoreTargets adds namespace targets from a snapshot. Targets already recorded are kept.
+func (l *Ledger) RestoreTargets(targets map[string]string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for namespace, rev := range targets {
+		if _, ok := l.targets[namespace]; !ok {
+			l.targets[namespace] = rev
+		}
+	}
+}
+
+// Restore adds entries from a snapshot, such as one saved by a previous leader. Entries already in
+// the ledger are kept.
+func (l *Ledger) Restore(entries map[ControllerKey]LedgerEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, entry := range entries {
+		if _, ok := l.entries[key]; !ok {
+			l.entries[key] = entry
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package governor
+
+// The ledger and the active restarts are kept in a ConfigMap in fortsa's own namespace, so when
+// fortsa is rescheduled, or another replica takes over as leader, it carries on where the last one
+// stopped instead of restarting everything again or losing track of rollouts still going.
+// Fortsa's leader election Role already allows managing ConfigMaps in that namespace.
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// key of the state in the ConfigMap's data
+const stateDataKey = "state.json"
+
+// ConfigMaps can't be bigger than 1MiB. If the state gets close, the oldest ledger entries are
+// dropped, which at worst means those controllers could be restarted once more.
+const maxStateSize = 900 * 1024
+
+type savedKey struct {
+	Group     string `json:"group,omitempty"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+type savedLedgerEntry struct {
+	savedKey
+	TargetRev   string    `json:"targetRev"`
+	RestartedAt time.Time `json:"restartedAt"`
+	Stepwise    bool      `json:"stepwise,omitempty"`
+}
+
+type savedActiveRestart struct {
+	savedKey
+	Version  string    `json:"version"`
+	Stepwise bool      `json:"stepwise,omitempty"`
+	Started  time.Time `json:"started"`
+}
+
+type savedState struct {
+	Ledger  []savedLedgerEntry   `json:"ledger"`
+	Active  []savedActiveRestart `json:"active"`
+	Targets map[string]string    `json:"targets,omitempty"`
+}
+
+func toSavedKey(key ControllerKey) savedKey {
+	return savedKey{Group: key.Group, Kind: key.Kind, Namespace: key.Namespace, Name: key.Name}
+}
+
+func (k savedKey) controllerKey() ControllerKey {
+	return ControllerKey{
+		GroupKind:      schema.GroupKind{Group: k.Group, Kind: k.Kind},
+		NamespacedName: types.NamespacedName{Namespace: k.Namespace, Name: k.Name},
+	}
+}
+
+// Store saves the governor's active restarts and the ledger in a ConfigMap, and loads them back
+type Store struct {
+	// the ConfigMap is read directly from the API server, so it isn't cached
+	reader ctrlclient.Reader
+	client ctrlclient.Client
+	key    types.NamespacedName
+
+	mu        sync.Mutex
+	loaded    bool
+	lastSaved string
+}
+
+// NewStore returns a Store keeping state in the named ConfigMap
+func NewStore(reader ctrlclient.Reader, client ctrlclient.Client, namespace, name string) *Store {
+	return &Store{reader: reader, client: client, key: types.NamespacedName{Namespace: namespace, Name: name}}
+}
+
+// Load restores the saved state into the governor and ledger. Only the first successful call does
+// anything, so it can be called at the start of every reconcile, which only happens once this
+// replica is the leader.
+func (s *Store) Load(ctx context.Context, g *Governor, l *Ledger) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loaded {
+		return nil
+	}
+
+	var cm = &corev1.ConfigMap{}
+	err := s.reader.Get(ctx, s.key, cm)
+	if apierrors.IsNotFound(err) {
+		s.loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state savedState
+	if data := cm.Data[stateDataKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &state); err != nil {
+			return err
+		}
+	}
+
+	var entries = make(map[ControllerKey]LedgerEntry)
+	for _, e := range state.Ledger {
+		entries[e.controllerKey()] = LedgerEntry{TargetRev: e.TargetRev, RestartedAt: e.RestartedAt, Stepwise: e.Stepwise}
+	}
+	l.Restore(entries)
+	l.RestoreTargets(state.Targets)
+
+	var active = make(map[ControllerKey]ActiveRestart)
+	for _, a := range state.Active {
+		active[a.controllerKey()] = ActiveRestart{
+			GVK:      schema.GroupVersionKind{Group: a.Group, Version: a.Version, Kind: a.Kind},
+			Stepwise: a.Stepwise,
+			Started:  a.Started,
+		}
+	}
+	g.Restore(active)
+
+	s.lastSaved = cm.Data[stateDataKey]
+	s.loaded = true
+	return nil
+}
+
+// Save writes the current state of the governor and ledger to the ConfigMap, if it has changed
+// since it was last saved
+func (s *Store) Save(ctx context.Context, g *Governor, l *Ledger) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loaded {
+		// don't overwrite state we haven't seen yet
+		return nil
+	}
+
+	data, err := marshalState(g.Snapshot(), l.Snapshot(), l.Targets())
+	if err != nil {
+		return err
+	}
+	if data == s.lastSaved {
+		return nil
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var cm = &corev1.ConfigMap{}
+		err := s.reader.Get(ctx, s.key, cm)
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: s.key.Namespace, Name: s.key.Name},
+				Data:       map[string]string{stateDataKey: data},
+			}
+			return s.client.Create(ctx, cm)
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[stateDataKey] = data
+		return s.client.Update(ctx, cm)
+	})
+	if err != nil {
+		return err
+	}
+	s.lastSaved = data
+	return nil
+}
+
+// marshalState serializes the state in a stable order, so unchanged state serializes the same way
+func marshalState(active map[ControllerKey]ActiveRestart, entries map[ControllerKey]LedgerEntry,
+	targets map[string]string) (string, error) {
+	var state = savedState{Ledger: []savedLedgerEntry{}, Active: []savedActiveRestart{}, Targets: targets}
+	for key, a := range active {
+		state.Active = append(state.Active, savedActiveRestart{
+			savedKey: toSavedKey(key), Version: a.GVK.Version, Stepwise: a.Stepwise, Started: a.Started,
+		})
+	}
+	sort.Slice(state.Active, func(i, j int) bool {
+		return state.Active[i].controllerKey().String() < state.Active[j].controllerKey().String()
+	})
+
+	for key, e := range entries {
+		state.Ledger = append(state.Ledger, savedLedgerEntry{
+			savedKey: toSavedKey(key), TargetRev: e.TargetRev, RestartedAt: e.RestartedAt, Stepwise: e.Stepwise,
+		})
+	}
+	// newest first, so the oldest are the ones dropped if there are too many
+	sort.Slice(state.Ledger, func(i, j int) bool {
+		if !state.Ledger[i].RestartedAt.Equal(state.Ledger[j].RestartedAt) {
+			return state.Ledger[i].RestartedAt.After(state.Ledger[j].RestartedAt)
+		}
+		return state.Ledger[i].controllerKey().String() < state.Ledger[j].controllerKey().String()
+	})
+
+	for {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return "", err
+		}
+		if len(data) <= maxStateSize || len(state.Ledger) == 0 {
+			return string(data), nil
+		}
+		state.Ledger = state.Ledger[:len(state.Ledger)*3/4]
+	}
+}
@@ -0,0 +1,80 @@
+package governor
+
+// Namespaces labelled with a wave are restarted a wave at a time, lowest first. A namespace holds
+// up later waves until it's settled, with nothing left to restart and nothing rolling out, and has
+// stayed that way for the bake time, so problems with a new revision show up in early waves before
+// they reach later ones.
+
+import (
+	"sync"
+	"time"
+)
+
+// WaveStatus is how far a namespace in a wave has got
+type WaveStatus struct {
+	Wave int
+
+	// istio revision the namespace's pods were being restarted towards
+	TargetRev string
+
+	// nothing is left to restart in the namespace, and nothing is rolling out
+	Settled bool
+
+	// when the namespace was last seen to become settled or unsettled, or first seen at all
+	Since time.Time
+}
+
+// Baking returns how long until the settled namespace has been settled for the bake time, or
+// zero if it already has
+func (s WaveStatus) Baking(bakeTime time.Duration) time.Duration {
+	return max(bakeTime-time.Since(s.Since), 0)
+}
+
+// Waves tracks the namespaces in waves. It is safe for concurrent use.
+type Waves struct {
+	mu         sync.Mutex
+	namespaces map[string]WaveStatus
+}
+
+// NewWaves returns a Waves tracking no namespaces
+func NewWaves() *Waves {
+	return &Waves{namespaces: make(map[string]WaveStatus)}
+}
+
+// Record records the namespace's wave, its target revision and whether it's settled. The bake time
+// of a namespace starts when it's first seen to be settled, even when it's first seen at all, since
+// there's no telling how long it's been settled for, and starts over when its target changes.
+func (w *Waves) Record(namespace string, wave int, targetRev string, settled bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status, ok := w.namespaces[namespace]
+	if !ok || status.Settled != settled || status.TargetRev != targetRev {
+		status = WaveStatus{TargetRev: targetRev, Settled: settled, Since: time.Now()}
+	}
+	status.Wave = wave
+	w.namespaces[namespace] = status
+}
+
+// Unsettle records that the namespace has work to do again, for when its target revision changes
+func (w *Waves) Unsettle(namespace string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if status, ok := w.namespaces[namespace]; ok && status.Settled {
+		w.namespaces[namespace] = WaveStatus{Wave: status.Wave, TargetRev: status.TargetRev, Since: time.Now()}
+	}
+}
+
+// Forget stops tracking the namespace, for when it's gone or no longer in a wave
+func (w *Waves) Forget(namespace string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.namespaces, namespace)
+}
+
+// Get returns the namespace's status, if it's being tracked
+func (w *Waves) Get(namespace string) (WaveStatus, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status, ok := w.namespaces[namespace]
+	return status, ok
+}
@@ -0,0 +1,94 @@
+package k8s
+
+// Argo Rollouts have their own restart mechanism: setting spec.restartAt makes the Rollout
+// controller replace every pod created before that time, honouring the Rollout's own disruption
+// settings. Once it's done it copies the time to status.restartedAt.
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// allow update/patch on Argo Rollouts
+//+kubebuilder:rbac:groups=argoproj.io,resources=rollouts,verbs=get;list;watch;update;patch
+
+// ArgoRolloutGVK identifies Argo Rollouts
+var ArgoRolloutGVK = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}
+
+// Argo Rollout status phases we care about
+const (
+	argoRolloutPhaseHealthy  = "Healthy"
+	argoRolloutPhaseDegraded = "Degraded"
+	argoRolloutPhasePaused   = "Paused"
+)
+
+// IsArgoRolloutComplete returns true if the Rollout has finished any restart requested through
+// spec.restartAt, and its status phase says it's healthy. It also returns the phase.
+//
+// A Rollout paused at a canary step is waiting on a promotion, which may never come from anything
+// fortsa does, so it counts as complete rather than being waited on forever. Paused Rollouts
+// aren't restarted though, and any restart already asked for happens once they're resumed.
+func IsArgoRolloutComplete(obj *unstructured.Unstructured) (bool, string) {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	if phase == argoRolloutPhasePaused {
+		return true, phase
+	}
+	restartAt, _, _ := unstructured.NestedString(obj.Object, "spec", "restartAt")
+	restartedAt, _, _ := unstructured.NestedString(obj.Object, "status", "restartedAt")
+
+	if restartAt != "" && restartAt != restartedAt {
+		return false, phase
+	}
+	return phase == argoRolloutPhaseHealthy, phase
+}
+
+// DoArgoRolloutRestart asks the Argo Rollout to restart its pods by setting spec.restartAt
+func DoArgoRolloutRestart(ctx context.Context, client ctrlclient.Client, obj *unstructured.Unstructured, dryRun bool) error {
+	log := log.FromContext(ctx)
+	log.Info("Attempting Argo Rollout restart", "obj", obj.GetName(), "ns", obj.GetNamespace())
+
+	if dryRun {
+		log.Info("Dry Run Mode: Not Patching Resource",
+			"ns", obj.GetNamespace(), "podController", obj.GetName(), "podControllerKind", obj.GetKind())
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"spec": map[string]any{
+			"restartAt": time.Now().UTC().Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return client.Patch(ctx, obj, ctrlclient.RawPatch(ctrlclient.Merge.Type(), patch))
+}
+
+// argoRolloutRestarter restarts Argo Rollouts
+type argoRolloutRestarter struct{}
+
+func (argoRolloutRestarter) CanRestart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, string) {
+	switch _, phase := IsArgoRolloutComplete(obj); phase {
+	case argoRolloutPhaseDegraded:
+		return false, "Argo Rollout is degraded and needs manual intervention"
+	case argoRolloutPhasePaused:
+		return false, "Argo Rollout is paused, and won't be restarted until it's resumed"
+	}
+	return true, ""
+}
+
+func (argoRolloutRestarter) IsRolloutComplete(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	complete, _ := IsArgoRolloutComplete(obj)
+	return complete, nil
+}
+
+func (argoRolloutRestarter) Restart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, error) {
+	// check back to track the restart through to completion
+	return !req.DryRun, DoArgoRolloutRestart(ctx, req.Client, obj, req.DryRun)
+}
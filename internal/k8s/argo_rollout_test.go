@@ -0,0 +1,62 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = Describe("Argo Rollouts", func() {
+	rollout := func(phase, restartAt, restartedAt string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]any{"spec": map[string]any{}, "status": map[string]any{}}}
+		obj.SetGroupVersionKind(ArgoRolloutGVK)
+		if phase != "" {
+			Expect(unstructured.SetNestedField(obj.Object, phase, "status", "phase")).To(Succeed())
+		}
+		if restartAt != "" {
+			Expect(unstructured.SetNestedField(obj.Object, restartAt, "spec", "restartAt")).To(Succeed())
+		}
+		if restartedAt != "" {
+			Expect(unstructured.SetNestedField(obj.Object, restartedAt, "status", "restartedAt")).To(Succeed())
+		}
+		return obj
+	}
+
+	const earlier, later = "2025-01-01T00:00:00Z", "2025-01-01T01:00:00Z"
+
+	DescribeTable("whether a Rollout is complete, and whether it can be restarted",
+		func(obj *unstructured.Unstructured, complete, restartable bool) {
+			done, _ := IsArgoRolloutComplete(obj)
+			Expect(done).To(Equal(complete))
+			canRestart, _ := argoRolloutRestarter{}.CanRestart(context.Background(), obj, RestartRequest{})
+			Expect(canRestart).To(Equal(restartable))
+		},
+		Entry("healthy", rollout("Healthy", "", ""), true, true),
+		Entry("healthy after its restart", rollout("Healthy", later, later), true, true),
+		Entry("progressing", rollout("Progressing", "", ""), false, true),
+		Entry("healthy, but its restart isn't done", rollout("Healthy", later, earlier), false, true),
+		Entry("restart never picked up", rollout("Healthy", later, ""), false, true),
+		Entry("paused at a canary step", rollout("Paused", "", ""), true, false),
+		Entry("paused with a restart waiting", rollout("Paused", later, earlier), true, false),
+		Entry("degraded", rollout("Degraded", "", ""), false, false),
+	)
+})
@@ -0,0 +1,337 @@
+package k8s
+
+// Evicting outdated pods is an alternative to patching their controllers. Nothing about the
+// controller changes, so GitOps tools like Argo CD or Flux don't see any drift, and because it goes
+// through the Eviction API, PodDisruptionBudgets are honoured by the API server.
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// allow evicting pods
+//+kubebuilder:rbac:groups=core,resources=pods/eviction,verbs=create
+
+// how long to wait before trying again to evict a pod whose eviction was blocked by its
+// PodDisruptionBudget. The wait doubles each time it's blocked again, up to the maximum.
+const (
+	evictionBackoffInitial = 5 * time.Second
+	evictionBackoffMax     = 5 * time.Minute
+)
+
+// Evictor evicts pods, keeping no more than a set number of the pods it evicted terminating at
+// once, across every namespace
+type Evictor struct {
+	client         ctrlclient.Client
+	maxTerminating int
+	now            func() time.Time
+
+	mu sync.Mutex
+	// pods evicted that haven't gone away yet
+	terminating map[types.UID]types.NamespacedName
+	// pods whose eviction was blocked, and when to try them again
+	blocked map[types.UID]evictionBackoff
+}
+
+type evictionBackoff struct {
+	pod     types.NamespacedName
+	delay   time.Duration
+	retryAt time.Time
+}
+
+// NewEvictor returns an Evictor allowing up to maxTerminating evicted pods to be terminating at once
+func NewEvictor(client ctrlclient.Client, maxTerminating int) *Evictor {
+	return &Evictor{
+		client:         client,
+		maxTerminating: max(maxTerminating, 1),
+		now:            time.Now,
+		terminating:    make(map[types.UID]types.NamespacedName),
+		blocked:        make(map[types.UID]evictionBackoff),
+	}
+}
+
+// EvictPods evicts as many of the given pods as the limit on terminating pods allows, and returns
+// the number evicted. Evictions the API server refuses with a 429, which is what happens when the
+// pod's PodDisruptionBudget doesn't currently allow a disruption, aren't waited on. Those pods are
+// backed off instead, and skipped until their backoff is over. RetryAfter says when that is.
+func (e *Evictor) EvictPods(ctx context.Context, pods []metav1.PartialObjectMetadata, dryRun bool) (int, error) {
+	log := log.FromContext(ctx)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.forgetGonePods(ctx)
+
+	var evicted int
+	for _, pod := range pods {
+		if !dryRun && len(e.terminating) >= e.maxTerminating {
+			log.Info("Too many evicted pods still terminating, waiting to evict more",
+				"terminating", len(e.terminating), "remaining", len(pods)-evicted)
+			break
+		}
+		if e.isBackedOff(pod) {
+			continue
+		}
+		ok, err := e.evictPod(ctx, pod, dryRun)
+		if err != nil {
+			return evicted, err
+		}
+		if ok {
+			evicted++
+			e.terminating[pod.UID] = types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
+		}
+	}
+	return evicted, nil
+}
+
+// RetryAfter returns how long until the soonest blocked eviction of a pod in the namespace may be
+// tried again, or zero if none are waiting
+func (e *Evictor) RetryAfter(namespace string) time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var now = e.now()
+	var retryAfter time.Duration
+	for _, backoff := range e.blocked {
+		if backoff.pod.Namespace != namespace || !backoff.retryAt.After(now) {
+			continue
+		}
+		if wait := backoff.retryAt.Sub(now); retryAfter == 0 || wait < retryAfter {
+			retryAfter = wait
+		}
+	}
+	return retryAfter
+}
+
+// notBackedOff returns the pods whose evictions aren't waiting out a backoff
+func (e *Evictor) notBackedOff(pods []metav1.PartialObjectMetadata) []metav1.PartialObjectMetadata {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var ready []metav1.PartialObjectMetadata
+	for _, pod := range pods {
+		if !e.isBackedOff(pod) {
+			ready = append(ready, pod)
+		}
+	}
+	return ready
+}
+
+func (e *Evictor) isBackedOff(pod metav1.PartialObjectMetadata) bool {
+	backoff, ok := e.blocked[pod.UID]
+	return ok && e.now().Before(backoff.retryAt)
+}
+
+// backOff records that the pod's eviction was blocked, doubling its wait if it was blocked before,
+// and returns how long to wait before trying it again
+func (e *Evictor) backOff(pod metav1.PartialObjectMetadata) time.Duration {
+	var delay = evictionBackoffInitial
+	if backoff, ok := e.blocked[pod.UID]; ok {
+		delay = min(2*backoff.delay, evictionBackoffMax)
+	}
+	e.blocked[pod.UID] = evictionBackoff{
+		pod:     types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name},
+		delay:   delay,
+		retryAt: e.now().Add(delay),
+	}
+	return delay
+}
+
+// forgetGonePods stops tracking evicted or blocked pods that have gone away, or been replaced
+func (e *Evictor) forgetGonePods(ctx context.Context) {
+	for uid, key := range e.terminating {
+		if e.isGone(ctx, uid, key) {
+			delete(e.terminating, uid)
+		}
+	}
+	for uid, backoff := range e.blocked {
+		if e.isGone(ctx, uid, backoff.pod) {
+			delete(e.blocked, uid)
+		}
+	}
+}
+
+func (e *Evictor) isGone(ctx context.Context, uid types.UID, key types.NamespacedName) bool {
+	var pod = NewPodMetadata()
+	err := e.client.Get(ctx, key, pod)
+	return apierrors.IsNotFound(err) || (err == nil && pod.UID != uid)
+}
+
+func (e *Evictor) evictPod(ctx context.Context, pod metav1.PartialObjectMetadata, dryRun bool) (bool, error) {
+	log := log.FromContext(ctx)
+
+	if dryRun {
+		log.Info("Dry Run Mode: Not Evicting Pod", "ns", pod.Namespace, "pod", pod.Name)
+		return false, nil
+	}
+
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		DeleteOptions: &metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &pod.UID},
+		},
+	}
+	err := e.client.SubResource("eviction").Create(ctx, podStub(pod), eviction)
+	switch {
+	case err == nil:
+		log.Info("Evicted outdated pod", "ns", pod.Namespace, "pod", pod.Name)
+		delete(e.blocked, pod.UID)
+		return true, nil
+	case apierrors.IsTooManyRequests(err):
+		log.Info("Eviction blocked by PodDisruptionBudget, will retry later",
+			"ns", pod.Namespace, "pod", pod.Name, "retryAfter", e.backOff(pod))
+		return false, nil
+	case apierrors.IsNotFound(err) || apierrors.IsConflict(err):
+		// the pod went away or was replaced
+		delete(e.blocked, pod.UID)
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// EvictControllerPods evicts outdated pods of the given controller, keeping no more than
+// maxTerminating of its pods terminating at once. The controller is expected to recreate them. It
+// is meant to be called repeatedly; it returns true once no outdated pods remain.
+func EvictControllerPods(ctx context.Context, client ctrlclient.Client, evictor *Evictor, obj *unstructured.Unstructured,
+	isOutdated func(metav1.PartialObjectMetadata) bool, maxTerminating int, dryRun bool) (bool, error) {
+	log := log.FromContext(ctx)
+
+	rawSelector, found, err := unstructured.NestedMap(obj.Object, "spec", "selector")
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		return false, fmt.Errorf("%v %v/%v has no pod selector", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+	}
+	var labelSelector = &metav1.LabelSelector{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(rawSelector, labelSelector)
+	if err != nil {
+		return false, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return false, err
+	}
+	pods, err := listOwnedPods(ctx, client, obj, selector)
+	if err != nil {
+		return false, err
+	}
+
+	var terminating = 0
+	var outdated []metav1.PartialObjectMetadata
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			terminating++
+			continue
+		}
+		if isOutdated(pod) {
+			outdated = append(outdated, pod)
+		}
+	}
+	if len(outdated) == 0 {
+		return true, nil
+	}
+
+	var budget = maxTerminating - terminating
+	if budget <= 0 {
+		log.Info("Waiting for terminating pods to be replaced before evicting more",
+			"ns", obj.GetNamespace(), "podController", obj.GetName(), "podControllerKind", obj.GetKind(),
+			"terminating", terminating, "outdatedPods", len(outdated))
+		return false, nil
+	}
+	// pods still backed off would only use up the budget
+	outdated = evictor.notBackedOff(outdated)
+	if len(outdated) == 0 {
+		log.Info("Waiting to retry evictions blocked by PodDisruptionBudgets",
+			"ns", obj.GetNamespace(), "podController", obj.GetName(), "podControllerKind", obj.GetKind(),
+			"retryAfter", evictor.RetryAfter(obj.GetNamespace()))
+		return false, nil
+	}
+	if len(outdated) > budget {
+		outdated = outdated[:budget]
+	}
+
+	evicted, err := evictor.EvictPods(ctx, outdated, dryRun)
+	if err != nil {
+		return false, err
+	}
+	if dryRun {
+		return true, nil
+	}
+	log.Info("Evicted outdated pods of controller",
+		"ns", obj.GetNamespace(), "podController", obj.GetName(), "podControllerKind", obj.GetKind(),
+		"evicted", evicted, "attempted", len(outdated))
+	return false, nil
+}
+
+// listOwnedPods returns the pods matching the selector that are controlled by the owner, either
+// directly or through a ReplicaSet it controls, as the pods of Deployments are
+func listOwnedPods(ctx context.Context, client ctrlclient.Client, owner ctrlclient.Object,
+	selector labels.Selector) ([]metav1.PartialObjectMetadata, error) {
+	var replicaSets = &metav1.PartialObjectMetadataList{}
+	replicaSets.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("ReplicaSetList"))
+	err := client.List(ctx, replicaSets,
+		ctrlclient.InNamespace(owner.GetNamespace()),
+		ctrlclient.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+	var owners = map[types.UID]bool{owner.GetUID(): true}
+	for _, rs := range replicaSets.Items {
+		if metav1.IsControlledBy(&rs, owner) {
+			owners[rs.UID] = true
+		}
+	}
+
+	var podList = NewPodMetadataList()
+	err = client.List(ctx, podList,
+		ctrlclient.InNamespace(owner.GetNamespace()),
+		ctrlclient.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+	var pods []metav1.PartialObjectMetadata
+	for _, pod := range podList.Items {
+		if ref := metav1.GetControllerOf(&pod); ref != nil && owners[ref.UID] {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// evictRestarter restarts controllers of any kind by evicting their outdated pods, for the evict
+// restart strategy. The controllers themselves are left untouched.
+type evictRestarter struct{}
+
+// EvictRestarter is the Restarter used for every controller in namespaces using the evict strategy
+var EvictRestarter Restarter = evictRestarter{}
+
+func (evictRestarter) CanRestart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, string) {
+	if _, found, _ := unstructured.NestedMap(obj.Object, "spec", "selector"); !found {
+		return false, "It has no pod selector to find its outdated pods by"
+	}
+	return true, ""
+}
+
+// evictions only wait on the limits on terminating pods, not on rollouts
+func (evictRestarter) IsRolloutComplete(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	return true, nil
+}
+
+func (evictRestarter) Restart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, error) {
+	done, err := EvictControllerPods(ctx, req.Client, req.Evictor, obj, req.IsOutdated, req.MaxTerminating, req.DryRun)
+	return !done, err
+}
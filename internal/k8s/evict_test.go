@@ -0,0 +1,185 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+)
+
+var _ = Describe("Evictor", func() {
+	var ctx = context.Background()
+	var isController = true
+
+	var client ctrlclient.Client
+	var evictions map[string]int
+	var blocked map[string]bool
+
+	newPod := func(name string, owner metav1.Object, ownerKind string) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns", Name: name, UID: types.UID(name + "-uid"),
+			Labels:      map[string]string{"app": "web"},
+			Annotations: map[string]string{common.IstioRevLabel: "old"},
+		}}
+		if owner != nil {
+			pod.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: ownerKind, Name: owner.GetName(), UID: owner.GetUID(), Controller: &isController,
+			}}
+		}
+		return pod
+	}
+
+	asMetadata := func(pods ...*corev1.Pod) []metav1.PartialObjectMetadata {
+		var meta []metav1.PartialObjectMetadata
+		for _, pod := range pods {
+			meta = append(meta, metav1.PartialObjectMetadata{ObjectMeta: pod.ObjectMeta})
+		}
+		return meta
+	}
+
+	build := func(objs ...ctrlclient.Object) {
+		evictions = make(map[string]int)
+		blocked = make(map[string]bool)
+		client = fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithObjects(objs...).
+			WithInterceptorFuncs(interceptor.Funcs{
+				// evicted pods stay around, terminating, unless the test deletes them
+				SubResourceCreate: func(ctx context.Context, c ctrlclient.Client, subResource string,
+					obj ctrlclient.Object, sub ctrlclient.Object, opts ...ctrlclient.SubResourceCreateOption) error {
+					Expect(subResource).To(Equal("eviction"))
+					evictions[obj.GetName()]++
+					if blocked[obj.GetName()] {
+						return apierrors.NewTooManyRequests("disruption budget", 10)
+					}
+					return nil
+				},
+			}).
+			Build()
+	}
+
+	It("should back off pods whose eviction is blocked, doubling the wait until they're evicted", func() {
+		pod := newPod("web-1", nil, "")
+		build(pod)
+		blocked["web-1"] = true
+		evictor := NewEvictor(client, 5)
+		var now = time.Now()
+		evictor.now = func() time.Time { return now }
+
+		evicted, err := evictor.EvictPods(ctx, asMetadata(pod), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(evicted).To(BeZero())
+		Expect(evictor.RetryAfter("ns")).To(Equal(evictionBackoffInitial))
+		Expect(evictor.RetryAfter("other")).To(BeZero())
+
+		// it isn't tried again until the backoff is over
+		now = now.Add(evictionBackoffInitial / 2)
+		_, err = evictor.EvictPods(ctx, asMetadata(pod), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(evictions["web-1"]).To(Equal(1))
+		Expect(evictor.RetryAfter("ns")).To(Equal(evictionBackoffInitial / 2))
+
+		now = now.Add(evictionBackoffInitial / 2)
+		_, err = evictor.EvictPods(ctx, asMetadata(pod), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(evictions["web-1"]).To(Equal(2))
+		Expect(evictor.RetryAfter("ns")).To(Equal(2 * evictionBackoffInitial))
+
+		// the wait stops growing at the maximum
+		for range 10 {
+			now = now.Add(evictionBackoffMax)
+			_, err = evictor.EvictPods(ctx, asMetadata(pod), false)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(evictor.RetryAfter("ns")).To(Equal(evictionBackoffMax))
+
+		// and is reset once the pod is evicted
+		now = now.Add(evictionBackoffMax)
+		blocked["web-1"] = false
+		evicted, err = evictor.EvictPods(ctx, asMetadata(pod), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(evicted).To(Equal(1))
+		Expect(evictor.RetryAfter("ns")).To(BeZero())
+	})
+
+	It("should keep no more evicted pods terminating than allowed, across calls", func() {
+		pods := []*corev1.Pod{newPod("a-1", nil, ""), newPod("b-1", nil, ""), newPod("c-1", nil, "")}
+		build(pods[0], pods[1], pods[2])
+		evictor := NewEvictor(client, 2)
+
+		evicted, err := evictor.EvictPods(ctx, asMetadata(pods[0], pods[1]), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(evicted).To(Equal(2))
+
+		evicted, err = evictor.EvictPods(ctx, asMetadata(pods[2]), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(evicted).To(BeZero())
+		Expect(evictions).NotTo(HaveKey("c-1"))
+
+		// once an evicted pod is gone, another can be evicted
+		Expect(client.Delete(ctx, pods[0])).To(Succeed())
+		evicted, err = evictor.EvictPods(ctx, asMetadata(pods[2]), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(evicted).To(Equal(1))
+	})
+
+	It("should evict the outdated pods of a Deployment, through its ReplicaSets", func() {
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web", UID: types.UID("deploy-uid")},
+			Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+		}
+		replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns", Name: "web-abc", UID: types.UID("rs-uid"), Labels: map[string]string{"app": "web"},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "Deployment", Name: "web", UID: deployment.UID, Controller: &isController,
+			}},
+		}}
+		other := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "other", UID: types.UID("other-uid")}}
+		build(deployment, replicaSet, other, newPod("web-abc-1", replicaSet, "ReplicaSet"), newPod("other-1", other, "ReplicaSet"))
+
+		raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deployment)
+		Expect(err).NotTo(HaveOccurred())
+		obj := &unstructured.Unstructured{Object: raw}
+		obj.SetGroupVersionKind(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+
+		inProgress, err := EvictRestarter.Restart(ctx, obj, RestartRequest{
+			Client: client, Evictor: NewEvictor(client, 5), MaxTerminating: 5,
+			IsOutdated: func(pod metav1.PartialObjectMetadata) bool { return pod.Annotations[common.IstioRevLabel] == "old" },
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(evictions).To(Equal(map[string]int{"web-abc-1": 1}))
+	})
+})
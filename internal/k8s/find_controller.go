@@ -15,50 +15,82 @@ package k8s
 import (
 	"context"
 	"fmt"
-	"strings"
 
-	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/kubernetes"
-	ctrl "sigs.k8s.io/controller-runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-type PodNotFoundError struct{ msg string }
-
-func (e PodNotFoundError) Error() string { return e.msg }
-
 type ControllerNotFoundError struct{ msg string }
 
 func (e ControllerNotFoundError) Error() string { return e.msg }
 
-// I hate this function
-func FindPodController(ctx context.Context, kubeClient kubernetes.Clientset, pod corev1.Pod) (*unstructured.Unstructured, error) {
-	log := log.FromContext(ctx)
+// ControllerFinder finds the top-level controllers of pods. Owner references are followed using
+// metadata-only reads, which the manager's client serves from its cache, and every owner found is
+// remembered, so pods sharing a ReplicaSet only cost one lookup. Create one per reconcile, so
+// nothing it remembers gets stale.
+type ControllerFinder struct {
+	reader ctrlclient.Reader
+	mapper meta.RESTMapper
+
+	// top-level controllers found so far, keyed by the UID of the pods' immediate controller
+	found  map[types.UID]foundController
+	owners map[types.UID]foundOwner
+}
 
-	// take the k8s-client Pod object and convert it to a k8s-client dynamic object
+type foundController struct {
+	controller *unstructured.Unstructured
+	err        error
+}
 
-	dynamic := dynamic.NewForConfigOrDie(ctrl.GetConfigOrDie())
+type foundOwner struct {
+	owner *metav1.PartialObjectMetadata
+	err   error
+}
 
-	resourceId := schema.GroupVersionResource{
-		Group:    "",
-		Version:  "v1",
-		Resource: "pods",
+// NewControllerFinder returns a ControllerFinder reading through the given reader, typically the
+// manager's client, and using the mapper to resolve the kinds found in owner references.
+func NewControllerFinder(reader ctrlclient.Reader, mapper meta.RESTMapper) *ControllerFinder {
+	return &ControllerFinder{
+		reader: reader,
+		mapper: mapper,
+		found:  make(map[types.UID]foundController),
+		owners: make(map[types.UID]foundOwner),
 	}
+}
 
-	res, err := dynamic.Resource(resourceId).Namespace(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
-	if err != nil {
-		return nil, &PodNotFoundError{fmt.Sprintf("Couldn't find pod %v.%v: %v", pod.Name, pod.Namespace, err)}
+// FindPodController returns the top-level controller of the pod, or the pod itself if it has no
+// controller. The controller is returned in full, read directly from the API server, since
+// restarting it depends on its current spec and status.
+func (f *ControllerFinder) FindPodController(ctx context.Context, pod metav1.PartialObjectMetadata) (*unstructured.Unstructured, error) {
+	log := log.FromContext(ctx)
+
+	ownerRef := metav1.GetControllerOf(&pod)
+	if ownerRef == nil {
+		// the pod is its own controller
+		return f.getFull(ctx, schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, pod.Namespace, pod.Name)
 	}
 
-	// find the top-level controller
+	if found, ok := f.found[ownerRef.UID]; ok {
+		return found.controller, found.err
+	}
 
-	controller, err := getPodController(ctx, dynamic, res)
+	owner, err := f.FindPodControllerMetadata(ctx, pod)
+	if err != nil {
+		f.found[ownerRef.UID] = foundController{err: err}
+		return nil, err
+	}
+	controller, err := f.getFull(ctx, owner.GroupVersionKind(), owner.Namespace, owner.Name)
+	if err != nil {
+		err = &ControllerNotFoundError{fmt.Sprintf("Couldn't find controller of pod %v.%v: %v", pod.Name, pod.Namespace, err)}
+	}
+	f.found[ownerRef.UID] = foundController{controller: controller, err: err}
 	if err != nil {
-		return nil, &ControllerNotFoundError{fmt.Sprintf("Couldn't find controller of pod %v.%v: %v", pod.Name, pod.Namespace, err)}
+		return nil, err
 	}
 
 	log.Info("Found controller for outdated pod",
@@ -67,24 +99,72 @@ func FindPodController(ctx context.Context, kubeClient kubernetes.Clientset, pod
 	return controller, nil
 }
 
-func getPodController(ctx context.Context, dynamic dynamic.Interface, obj *unstructured.Unstructured) (owner *unstructured.Unstructured, err error) {
-	for _, oRef := range obj.GetOwnerReferences() {
-		if *oRef.Controller {
-			apiParts := strings.Split(oRef.APIVersion, "/")
-			resourceId := schema.GroupVersionResource{
-				Group:    apiParts[0],
-				Version:  apiParts[1],
-				Resource: strings.ToLower(oRef.Kind) + "s",
-			}
-			owner, err = dynamic.Resource(resourceId).Namespace(obj.GetNamespace()).Get(ctx, oRef.Name, metav1.GetOptions{})
-			if err != nil {
-				return nil, err
-			}
-			break
+// FindPodControllerMetadata returns the metadata of the top-level controller of the pod, or of the
+// pod itself if it has no controller. Unlike FindPodController, it only reads through the cache.
+func (f *ControllerFinder) FindPodControllerMetadata(ctx context.Context,
+	pod metav1.PartialObjectMetadata) (*metav1.PartialObjectMetadata, error) {
+	ownerRef := metav1.GetControllerOf(&pod)
+	if ownerRef == nil {
+		var self = pod.DeepCopy()
+		self.SetGroupVersionKind(schema.GroupVersionKind{Version: "v1", Kind: "Pod"})
+		return self, nil
+	}
+
+	if found, ok := f.owners[ownerRef.UID]; ok {
+		return found.owner, found.err
+	}
+
+	owner, err := f.findTopController(ctx, pod.Namespace, *ownerRef)
+	if err != nil {
+		err = &ControllerNotFoundError{fmt.Sprintf("Couldn't find controller of pod %v.%v: %v", pod.Name, pod.Namespace, err)}
+	}
+	f.owners[ownerRef.UID] = foundOwner{owner: owner, err: err}
+	return owner, err
+}
+
+// findTopController follows controller owner references up from the given one, and returns the
+// metadata of the last object found
+func (f *ControllerFinder) findTopController(ctx context.Context, namespace string,
+	ownerRef metav1.OwnerReference) (*metav1.PartialObjectMetadata, error) {
+	for {
+		gvk := schema.FromAPIVersionAndKind(ownerRef.APIVersion, ownerRef.Kind)
+		mapping, err := f.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, err
+		}
+		if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			return nil, fmt.Errorf("controller %v %v is not namespaced", gvk.Kind, ownerRef.Name)
+		}
+
+		owner := &metav1.PartialObjectMetadata{}
+		owner.SetGroupVersionKind(gvk)
+		err = f.reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ownerRef.Name}, owner)
+		if err != nil {
+			return nil, err
+		}
+		if owner.UID != ownerRef.UID {
+			return nil, fmt.Errorf("%v %v was replaced", gvk.Kind, ownerRef.Name)
+		}
+
+		next := metav1.GetControllerOf(owner)
+		if next == nil {
+			// the object read back doesn't always keep the GVK it was read as
+			owner.SetGroupVersionKind(gvk)
+			return owner, nil
 		}
+		ownerRef = *next
 	}
-	if owner == nil {
-		return obj, nil
+}
+
+// getFull reads the whole object. The manager's client doesn't cache unstructured objects, so this
+// goes to the API server.
+func (f *ControllerFinder) getFull(ctx context.Context, gvk schema.GroupVersionKind,
+	namespace, name string) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	err := f.reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, obj)
+	if err != nil {
+		return nil, err
 	}
-	return getPodController(ctx, dynamic, owner)
+	return obj, nil
 }
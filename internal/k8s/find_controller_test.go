@@ -0,0 +1,124 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("ControllerFinder", func() {
+	var ctx = context.Background()
+
+	controllerRef := func(obj metav1.Object, apiVersion, kind string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{
+			APIVersion: apiVersion, Kind: kind, Name: obj.GetName(), UID: obj.GetUID(),
+			Controller: func() *bool { b := true; return &b }(),
+		}}
+	}
+
+	asMetadata := func(pod *corev1.Pod) metav1.PartialObjectMetadata {
+		return metav1.PartialObjectMetadata{ObjectMeta: pod.ObjectMeta}
+	}
+
+	var deployment *appsv1.Deployment
+	var replicaSet *appsv1.ReplicaSet
+	var pods []*corev1.Pod
+	var gets int
+	var finder *ControllerFinder
+
+	BeforeEach(func() {
+		deployment = &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns", Name: "web", UID: types.UID("deploy-uid"),
+		}}
+		replicaSet = &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns", Name: "web-abc", UID: types.UID("rs-uid"),
+			OwnerReferences: controllerRef(deployment, "apps/v1", "Deployment"),
+		}}
+		pods = []*corev1.Pod{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-abc-1",
+				OwnerReferences: controllerRef(replicaSet, "apps/v1", "ReplicaSet")}},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-abc-2",
+				OwnerReferences: controllerRef(replicaSet, "apps/v1", "ReplicaSet")}},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "bare"}},
+		}
+
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), meta.RESTScopeNamespace)
+		mapper.Add(appsv1.SchemeGroupVersion.WithKind("ReplicaSet"), meta.RESTScopeNamespace)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("Pod"), meta.RESTScopeNamespace)
+
+		gets = 0
+		client := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithRESTMapper(mapper).
+			WithObjects(deployment, replicaSet, pods[0], pods[1], pods[2]).
+			WithInterceptorFuncs(interceptor.Funcs{
+				Get: func(ctx context.Context, c ctrlclient.WithWatch, key ctrlclient.ObjectKey,
+					obj ctrlclient.Object, opts ...ctrlclient.GetOption) error {
+					gets++
+					return c.Get(ctx, key, obj, opts...)
+				},
+			}).
+			Build()
+		finder = NewControllerFinder(client, mapper)
+	})
+
+	It("should find the top-level controller of a pod", func() {
+		controller, err := finder.FindPodController(ctx, asMetadata(pods[0]))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(controller.GetKind()).To(Equal("Deployment"))
+		Expect(controller.GetName()).To(Equal("web"))
+	})
+
+	It("should remember controllers it has already found", func() {
+		_, err := finder.FindPodController(ctx, asMetadata(pods[0]))
+		Expect(err).NotTo(HaveOccurred())
+		var firstGets = gets
+
+		controller, err := finder.FindPodController(ctx, asMetadata(pods[1]))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(controller.GetName()).To(Equal("web"))
+		Expect(gets).To(Equal(firstGets))
+	})
+
+	It("should return the pod itself when it has no controller", func() {
+		controller, err := finder.FindPodController(ctx, asMetadata(pods[2]))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(controller.GetKind()).To(Equal("Pod"))
+		Expect(controller.GetName()).To(Equal("bare"))
+	})
+
+	It("should fail for owner kinds the RESTMapper doesn't know", func() {
+		pod := asMetadata(pods[0])
+		pod.OwnerReferences = controllerRef(replicaSet, "example.com/v1", "Mystery")
+		_, err := finder.FindPodController(ctx, pod)
+		Expect(err).To(BeAssignableToTypeOf(&ControllerNotFoundError{}))
+	})
+})
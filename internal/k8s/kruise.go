@@ -0,0 +1,141 @@
+package k8s
+
+// OpenKruise workloads (CloneSet, Advanced StatefulSet and Advanced DaemonSet) are restarted the
+// same way as their built-in counterparts, by annotating their pod template, which lets Kruise roll
+// the pods according to the workload's own partition and maxUnavailable settings.
+//
+// Kruise can also update pods in place, but that can't upgrade a sidecar: an in-place update only
+// touches container images and metadata from the template, while the istio proxy is injected by a
+// webhook when the pod is created. When a workload is configured to prefer in-place updates, a
+// template annotation would just be copied onto the running pods, so for those we evict the
+// outdated pods instead and let Kruise recreate them. The same goes for Advanced StatefulSets and
+// DaemonSets with the OnDelete update strategy, which never replace pods on their own.
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// allow update/patch on OpenKruise workloads
+//+kubebuilder:rbac:groups=apps.kruise.io,resources=clonesets;statefulsets;daemonsets,verbs=get;list;watch;update;patch
+
+// API group of OpenKruise workloads
+const kruiseGroup = "apps.kruise.io"
+
+var (
+	// KruiseCloneSetGVK identifies OpenKruise CloneSets
+	KruiseCloneSetGVK = schema.GroupVersionKind{Group: kruiseGroup, Version: "v1alpha1", Kind: "CloneSet"}
+
+	// KruiseStatefulSetGVK identifies OpenKruise Advanced StatefulSets
+	KruiseStatefulSetGVK = schema.GroupVersionKind{Group: kruiseGroup, Version: "v1beta1", Kind: "StatefulSet"}
+
+	// KruiseDaemonSetGVK identifies OpenKruise Advanced DaemonSets
+	KruiseDaemonSetGVK = schema.GroupVersionKind{Group: kruiseGroup, Version: "v1alpha1", Kind: "DaemonSet"}
+)
+
+// KruiseUsesInPlaceUpdate returns true if the OpenKruise workload is configured to update pods in
+// place when it can, in which case annotating its pod template won't recreate any pods.
+func KruiseUsesInPlaceUpdate(obj *unstructured.Unstructured) bool {
+	var policy string
+	switch obj.GetKind() {
+	case KruiseCloneSetGVK.Kind:
+		policy, _, _ = unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type")
+	case KruiseStatefulSetGVK.Kind:
+		policy, _, _ = unstructured.NestedString(obj.Object, "spec", "updateStrategy", "rollingUpdate", "podUpdatePolicy")
+	case KruiseDaemonSetGVK.Kind:
+		policy, _, _ = unstructured.NestedString(obj.Object, "spec", "updateStrategy", "rollingUpdate", "type")
+	}
+	return policy == "InPlaceIfPossible" || policy == "InPlaceOnly"
+}
+
+// KruiseUsesOnDelete returns true if the Advanced StatefulSet or DaemonSet only replaces pods when
+// they're deleted, in which case annotating its pod template won't recreate any pods either.
+func KruiseUsesOnDelete(obj *unstructured.Unstructured) bool {
+	switch obj.GetKind() {
+	case KruiseStatefulSetGVK.Kind, KruiseDaemonSetGVK.Kind:
+		strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type")
+		return strategy == "OnDelete"
+	default:
+		return false
+	}
+}
+
+// kruiseEvictsPods returns true if the OpenKruise workload's outdated pods have to be evicted,
+// since changing its pod template wouldn't recreate them
+func kruiseEvictsPods(obj *unstructured.Unstructured) bool {
+	return KruiseUsesInPlaceUpdate(obj) || KruiseUsesOnDelete(obj)
+}
+
+// IsKruiseRolloutComplete returns true if the OpenKruise workload has finished rolling out its
+// current pod template, going by the workload's status. Workloads using the OnDelete strategy
+// never roll out on their own, so for those it's enough that all their pods are ready.
+func IsKruiseRolloutComplete(obj *unstructured.Unstructured) bool {
+	observedGeneration, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if observedGeneration < obj.GetGeneration() {
+		return false
+	}
+
+	if KruiseUsesOnDelete(obj) {
+		switch obj.GetKind() {
+		case KruiseStatefulSetGVK.Kind:
+			replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+			if !found {
+				replicas = 1
+			}
+			ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "readyReplicas")
+			return ready >= replicas
+		case KruiseDaemonSetGVK.Kind:
+			desired, _, _ := unstructured.NestedInt64(obj.Object, "status", "desiredNumberScheduled")
+			available, _, _ := unstructured.NestedInt64(obj.Object, "status", "numberAvailable")
+			return available >= desired
+		}
+	}
+
+	switch obj.GetKind() {
+	case KruiseCloneSetGVK.Kind, KruiseStatefulSetGVK.Kind:
+		replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if !found {
+			replicas = 1
+		}
+		// with an integer partition, that many pods are deliberately left on the old revision
+		partition, _, _ := unstructured.NestedInt64(obj.Object, "spec", "updateStrategy", "partition")
+		if obj.GetKind() == KruiseStatefulSetGVK.Kind {
+			partition, _, _ = unstructured.NestedInt64(obj.Object, "spec", "updateStrategy", "rollingUpdate", "partition")
+		}
+		updatedReady, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReadyReplicas")
+		return updatedReady >= replicas-partition
+	case KruiseDaemonSetGVK.Kind:
+		desired, _, _ := unstructured.NestedInt64(obj.Object, "status", "desiredNumberScheduled")
+		updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedNumberScheduled")
+		available, _, _ := unstructured.NestedInt64(obj.Object, "status", "numberAvailable")
+		return updated >= desired && available >= desired
+	default:
+		return false
+	}
+}
+
+// kruiseRestarter restarts OpenKruise workloads
+type kruiseRestarter struct{}
+
+func (kruiseRestarter) CanRestart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, string) {
+	if !kruiseEvictsPods(obj) && IsKruiseRolloutComplete(obj) && restartedSince(obj, defaultAnnotationsPath, req.Pod) {
+		return false, "OpenKruise workload finished rolling out without replacing this pod, not restarting it again"
+	}
+	return true, ""
+}
+
+func (kruiseRestarter) IsRolloutComplete(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	return IsKruiseRolloutComplete(obj), nil
+}
+
+func (kruiseRestarter) Restart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, error) {
+	// in-place updates can't re-inject a sidecar, and OnDelete workloads don't replace pods at all,
+	// so the pods have to be recreated
+	if kruiseEvictsPods(obj) {
+		done, err := EvictControllerPods(ctx, req.Client, req.Evictor, obj, req.IsOutdated, req.MaxTerminating, req.DryRun)
+		return !done, err
+	}
+	return !req.DryRun, DoRolloutRestart(ctx, req.Client, obj, req.DryRun)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("OpenKruise workloads", func() {
+	kruise := func(gvk schema.GroupVersionKind, spec, status map[string]any) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]any{"spec": spec, "status": status}}
+		obj.SetGroupVersionKind(gvk)
+		obj.SetGeneration(2)
+		if _, ok := status["observedGeneration"]; !ok {
+			status["observedGeneration"] = int64(2)
+		}
+		return obj
+	}
+
+	DescribeTable("which update strategies need pods evicted",
+		func(obj *unstructured.Unstructured, inPlace, onDelete bool) {
+			Expect(KruiseUsesInPlaceUpdate(obj)).To(Equal(inPlace))
+			Expect(KruiseUsesOnDelete(obj)).To(Equal(onDelete))
+		},
+		Entry("CloneSet recreating pods", kruise(KruiseCloneSetGVK,
+			map[string]any{"updateStrategy": map[string]any{"type": "ReCreate"}}, map[string]any{}), false, false),
+		Entry("CloneSet updating in place", kruise(KruiseCloneSetGVK,
+			map[string]any{"updateStrategy": map[string]any{"type": "InPlaceIfPossible"}}, map[string]any{}), true, false),
+		Entry("Advanced StatefulSet updating in place", kruise(KruiseStatefulSetGVK,
+			map[string]any{"updateStrategy": map[string]any{"rollingUpdate": map[string]any{"podUpdatePolicy": "InPlaceOnly"}}},
+			map[string]any{}), true, false),
+		Entry("Advanced StatefulSet with OnDelete", kruise(KruiseStatefulSetGVK,
+			map[string]any{"updateStrategy": map[string]any{"type": "OnDelete"}}, map[string]any{}), false, true),
+		Entry("Advanced DaemonSet updating in place", kruise(KruiseDaemonSetGVK,
+			map[string]any{"updateStrategy": map[string]any{"rollingUpdate": map[string]any{"type": "InPlaceIfPossible"}}},
+			map[string]any{}), true, false),
+		Entry("Advanced DaemonSet with OnDelete", kruise(KruiseDaemonSetGVK,
+			map[string]any{"updateStrategy": map[string]any{"type": "OnDelete"}}, map[string]any{}), false, true),
+	)
+
+	DescribeTable("whether a rollout is complete",
+		func(obj *unstructured.Unstructured, complete bool) {
+			Expect(IsKruiseRolloutComplete(obj)).To(Equal(complete))
+		},
+		Entry("CloneSet fully updated", kruise(KruiseCloneSetGVK,
+			map[string]any{"replicas": int64(5)}, map[string]any{"updatedReadyReplicas": int64(5)}), true),
+		Entry("CloneSet still updating", kruise(KruiseCloneSetGVK,
+			map[string]any{"replicas": int64(5)}, map[string]any{"updatedReadyReplicas": int64(4)}), false),
+		Entry("CloneSet updated up to its partition", kruise(KruiseCloneSetGVK,
+			map[string]any{"replicas": int64(5), "updateStrategy": map[string]any{"partition": int64(2)}},
+			map[string]any{"updatedReadyReplicas": int64(3)}), true),
+		Entry("CloneSet short of its partition", kruise(KruiseCloneSetGVK,
+			map[string]any{"replicas": int64(5), "updateStrategy": map[string]any{"partition": int64(2)}},
+			map[string]any{"updatedReadyReplicas": int64(2)}), false),
+		Entry("CloneSet status not yet observed", kruise(KruiseCloneSetGVK,
+			map[string]any{"replicas": int64(1)}, map[string]any{"observedGeneration": int64(1), "updatedReadyReplicas": int64(1)}), false),
+		Entry("Advanced StatefulSet updated up to its partition", kruise(KruiseStatefulSetGVK,
+			map[string]any{"replicas": int64(3), "updateStrategy": map[string]any{"rollingUpdate": map[string]any{"partition": int64(1)}}},
+			map[string]any{"updatedReadyReplicas": int64(2)}), true),
+		Entry("Advanced StatefulSet short of its partition", kruise(KruiseStatefulSetGVK,
+			map[string]any{"replicas": int64(3), "updateStrategy": map[string]any{"rollingUpdate": map[string]any{"partition": int64(1)}}},
+			map[string]any{"updatedReadyReplicas": int64(1)}), false),
+		Entry("Advanced StatefulSet with OnDelete and every pod ready", kruise(KruiseStatefulSetGVK,
+			map[string]any{"replicas": int64(3), "updateStrategy": map[string]any{"type": "OnDelete"}},
+			map[string]any{"readyReplicas": int64(3), "updatedReadyReplicas": int64(0)}), true),
+		Entry("Advanced StatefulSet with OnDelete and a pod not ready", kruise(KruiseStatefulSetGVK,
+			map[string]any{"replicas": int64(3), "updateStrategy": map[string]any{"type": "OnDelete"}},
+			map[string]any{"readyReplicas": int64(2)}), false),
+		Entry("Advanced DaemonSet fully updated", kruise(KruiseDaemonSetGVK, map[string]any{},
+			map[string]any{"desiredNumberScheduled": int64(3), "updatedNumberScheduled": int64(3), "numberAvailable": int64(3)}), true),
+		Entry("Advanced DaemonSet still updating", kruise(KruiseDaemonSetGVK, map[string]any{},
+			map[string]any{"desiredNumberScheduled": int64(3), "updatedNumberScheduled": int64(2), "numberAvailable": int64(3)}), false),
+		Entry("Advanced DaemonSet with OnDelete and every pod available", kruise(KruiseDaemonSetGVK,
+			map[string]any{"updateStrategy": map[string]any{"type": "OnDelete"}},
+			map[string]any{"desiredNumberScheduled": int64(3), "updatedNumberScheduled": int64(0), "numberAvailable": int64(3)}), true),
+	)
+})
@@ -0,0 +1,161 @@
+package k8s
+
+// StatefulSets and DaemonSets using the OnDelete update strategy never replace their pods on their
+// own. Patching the pod template (which is what DoRolloutRestart does) only records a new revision,
+// so for those controllers we have to delete the outdated pods ourselves, one at a time, and let
+// the controller recreate them.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// allow deleting pods of controllers using the OnDelete update strategy
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;delete
+
+// IsOnDeleteStrategy returns true if the object is a StatefulSet or DaemonSet whose update
+// strategy is OnDelete, meaning a rollout restart won't replace any of its pods.
+func IsOnDeleteStrategy(obj *unstructured.Unstructured) bool {
+	switch obj.GetKind() {
+	case "StatefulSet", "DaemonSet":
+		strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type")
+		return strategy == "OnDelete"
+	default:
+		return false
+	}
+}
+
+// DoOnDeleteRestart deletes at most one outdated pod of the given OnDelete StatefulSet or DaemonSet,
+// and only once every pod of the controller is Ready. StatefulSet pods are deleted in reverse ordinal
+// order, the same order the StatefulSet controller itself uses for rolling updates. It is meant to be
+// called repeatedly; it returns true once no outdated pods remain.
+func DoOnDeleteRestart(ctx context.Context, client ctrlclient.Client, obj *unstructured.Unstructured,
+	isOutdated func(metav1.PartialObjectMetadata) bool, dryRun bool) (bool, error) {
+	log := log.FromContext(ctx)
+
+	key := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+
+	var owner ctrlclient.Object
+	var selector *metav1.LabelSelector
+	var settled bool
+	switch obj.GetKind() {
+	case "StatefulSet":
+		sts := &appsv1.StatefulSet{}
+		if err := client.Get(ctx, key, sts); err != nil {
+			return false, err
+		}
+		replicas := int32(1)
+		if sts.Spec.Replicas != nil {
+			replicas = *sts.Spec.Replicas
+		}
+		owner, selector = sts, sts.Spec.Selector
+		settled = sts.Status.ObservedGeneration >= sts.Generation &&
+			sts.Status.Replicas == replicas && sts.Status.ReadyReplicas == replicas
+	case "DaemonSet":
+		ds := &appsv1.DaemonSet{}
+		if err := client.Get(ctx, key, ds); err != nil {
+			return false, err
+		}
+		owner, selector = ds, ds.Spec.Selector
+		settled = ds.Status.ObservedGeneration >= ds.Generation &&
+			ds.Status.NumberReady == ds.Status.DesiredNumberScheduled && ds.Status.NumberUnavailable == 0
+	default:
+		return false, fmt.Errorf("unsupported Kind %v for OnDelete restart", obj.GetKind())
+	}
+
+	podSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, err
+	}
+	pods, err := listControlledPods(ctx, client, owner, podSelector)
+	if err != nil {
+		return false, err
+	}
+
+	var outdated []metav1.PartialObjectMetadata
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			// a previously deleted pod hasn't gone away yet
+			settled = false
+			continue
+		}
+		if isOutdated(pod) {
+			outdated = append(outdated, pod)
+		}
+	}
+	if len(outdated) == 0 {
+		return true, nil
+	}
+	if !settled {
+		log.Info("Waiting for pods to become Ready before deleting the next outdated pod",
+			"ns", obj.GetNamespace(), "podController", obj.GetName(), "podControllerKind", obj.GetKind(),
+			"outdatedPods", len(outdated))
+		return false, nil
+	}
+
+	sort.SliceStable(outdated, func(i, j int) bool {
+		return podOrdinal(outdated[i].Name) > podOrdinal(outdated[j].Name)
+	})
+	victim := outdated[0]
+
+	if dryRun {
+		log.Info("Dry Run Mode: Not Deleting Pod",
+			"ns", victim.Namespace, "pod", victim.Name,
+			"podController", obj.GetName(), "podControllerKind", obj.GetKind())
+		// nothing will change, so don't keep the caller waiting on us
+		return true, nil
+	}
+
+	log.Info("Deleting outdated pod of OnDelete controller",
+		"ns", victim.Namespace, "pod", victim.Name,
+		"podController", obj.GetName(), "podControllerKind", obj.GetKind(), "remaining", len(outdated)-1)
+	err = client.Delete(ctx, podStub(victim), ctrlclient.Preconditions{UID: &victim.UID})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	return false, nil
+}
+
+// listControlledPods returns the pods matching the selector that are controlled by the owner
+func listControlledPods(ctx context.Context, client ctrlclient.Client, owner ctrlclient.Object,
+	selector labels.Selector) ([]metav1.PartialObjectMetadata, error) {
+	var podList = NewPodMetadataList()
+	err := client.List(ctx, podList,
+		ctrlclient.InNamespace(owner.GetNamespace()),
+		ctrlclient.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+	var pods []metav1.PartialObjectMetadata
+	for _, pod := range podList.Items {
+		if metav1.IsControlledBy(&pod, owner) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// podOrdinal returns the StatefulSet ordinal at the end of a pod name, or -1 if there isn't one
+func podOrdinal(podName string) int {
+	idx := strings.LastIndex(podName, "-")
+	if idx < 0 {
+		return -1
+	}
+	ordinal, err := strconv.Atoi(podName[idx+1:])
+	if err != nil {
+		return -1
+	}
+	return ordinal
+}
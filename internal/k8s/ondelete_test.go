@@ -0,0 +1,136 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+)
+
+var _ = Describe("OnDelete restarts", func() {
+	var ctx = context.Background()
+	var isController = true
+
+	var sts *appsv1.StatefulSet
+	var pods []*corev1.Pod
+
+	isOutdated := func(pod metav1.PartialObjectMetadata) bool {
+		return pod.Annotations[common.IstioRevLabel] != "new"
+	}
+
+	newPod := func(name, rev string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns", Name: name, UID: types.UID(name + "-uid"),
+			Labels:      map[string]string{"app": "db"},
+			Annotations: map[string]string{common.IstioRevLabel: rev},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "StatefulSet", Name: sts.Name, UID: sts.UID, Controller: &isController,
+			}},
+		}}
+	}
+
+	restart := func() (ctrlclient.Client, bool) {
+		var objs = []ctrlclient.Object{sts}
+		for _, pod := range pods {
+			objs = append(objs, pod)
+		}
+		client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objs...).Build()
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("StatefulSet"))
+		obj.SetNamespace(sts.Namespace)
+		obj.SetName(sts.Name)
+		done, err := DoOnDeleteRestart(ctx, client, obj, isOutdated, false)
+		Expect(err).NotTo(HaveOccurred())
+		return client, done
+	}
+
+	exists := func(client ctrlclient.Client, name string) bool {
+		err := client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: name}, &corev1.Pod{})
+		if apierrors.IsNotFound(err) {
+			return false
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return true
+	}
+
+	BeforeEach(func() {
+		var replicas int32 = 3
+		sts = &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "db", UID: types.UID("sts-uid")},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			},
+			Status: appsv1.StatefulSetStatus{Replicas: 3, ReadyReplicas: 3},
+		}
+		pods = []*corev1.Pod{newPod("db-0", "old"), newPod("db-10", "old"), newPod("db-2", "old")}
+	})
+
+	It("should delete the outdated pod with the highest ordinal first", func() {
+		client, done := restart()
+		Expect(done).To(BeFalse())
+		Expect(exists(client, "db-10")).To(BeFalse())
+		Expect(exists(client, "db-2")).To(BeTrue())
+		Expect(exists(client, "db-0")).To(BeTrue())
+	})
+
+	It("should skip pods that are already up to date", func() {
+		pods[1] = newPod("db-10", "new")
+		client, _ := restart()
+		Expect(exists(client, "db-10")).To(BeTrue())
+		Expect(exists(client, "db-2")).To(BeFalse())
+	})
+
+	It("should wait for every pod to be Ready before deleting another", func() {
+		sts.Status.ReadyReplicas = 2
+		client, done := restart()
+		Expect(done).To(BeFalse())
+		for _, pod := range pods {
+			Expect(exists(client, pod.Name)).To(BeTrue())
+		}
+	})
+
+	It("should wait for a pod being deleted to go away", func() {
+		var now = metav1.Now()
+		pods[1].DeletionTimestamp = &now
+		pods[1].Finalizers = []string{"example.com/hold"}
+		client, done := restart()
+		Expect(done).To(BeFalse())
+		Expect(exists(client, "db-2")).To(BeTrue())
+		Expect(exists(client, "db-0")).To(BeTrue())
+	})
+
+	It("should be done once no outdated pods remain", func() {
+		pods = []*corev1.Pod{newPod("db-0", "new"), newPod("db-1", "new"), newPod("db-2", "new")}
+		_, done := restart()
+		Expect(done).To(BeTrue())
+	})
+})
@@ -0,0 +1,75 @@
+package k8s
+
+// We only ever need pod metadata: the sidecar's revision is in an annotation, and everything else
+// we look at is in the owner references, labels and timestamps. Reading pods as
+// PartialObjectMetadata makes the manager's cache hold metadata-only pods, which keeps its memory
+// use flat in clusters with lots of pods, and the field index on the revision annotation lets us
+// query pods with sidecars without going through every pod in a namespace.
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+)
+
+// PodIstioRevIndex is the name of the field index on the istio revision annotation of pods
+const PodIstioRevIndex = "metadata.annotations." + common.IstioRevLabel
+
+// every pod with an istio sidecar is also indexed under this value, whatever its revision
+const anyIstioRev = "*"
+
+// NewPodMetadata returns an empty metadata-only pod, for reading pods through the cache
+func NewPodMetadata() *metav1.PartialObjectMetadata {
+	var pod = &metav1.PartialObjectMetadata{}
+	pod.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Pod"))
+	return pod
+}
+
+// NewPodMetadataList returns an empty list of metadata-only pods, for listing pods through the cache
+func NewPodMetadataList() *metav1.PartialObjectMetadataList {
+	var pods = &metav1.PartialObjectMetadataList{}
+	pods.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("PodList"))
+	return pods
+}
+
+// IndexPods registers the field index on the istio revision annotation of metadata-only pods
+func IndexPods(ctx context.Context, indexer ctrlclient.FieldIndexer) error {
+	return indexer.IndexField(ctx, NewPodMetadata(), PodIstioRevIndex, podIstioRevIndexValues)
+}
+
+func podIstioRevIndexValues(obj ctrlclient.Object) []string {
+	var rev = obj.GetAnnotations()[common.IstioRevLabel]
+	if rev == "" {
+		return nil
+	}
+	return []string{rev, anyIstioRev}
+}
+
+// ListPodsWithRev returns the pods in the namespace with sidecars from the given istio revision.
+// An empty namespace means all namespaces.
+func ListPodsWithRev(ctx context.Context, reader ctrlclient.Reader, namespace, rev string) ([]metav1.PartialObjectMetadata, error) {
+	var pods = NewPodMetadataList()
+	err := reader.List(ctx, pods,
+		ctrlclient.InNamespace(namespace),
+		ctrlclient.MatchingFields{PodIstioRevIndex: rev})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// ListInjectedPods returns the pods in the namespace with istio sidecars, from any revision. An
+// empty namespace means all namespaces.
+func ListInjectedPods(ctx context.Context, reader ctrlclient.Reader, namespace string) ([]metav1.PartialObjectMetadata, error) {
+	return ListPodsWithRev(ctx, reader, namespace, anyIstioRev)
+}
+
+// podStub returns a typed pod carrying just enough to identify the pod, for API calls that need a
+// pod object rather than its metadata
+func podStub(pod metav1.PartialObjectMetadata) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID}}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+)
+
+var _ = Describe("Pod index", func() {
+	var ctx = context.Background()
+	var client ctrlclient.Client
+
+	newPod := func(ns, name, rev string) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name}}
+		if rev != "" {
+			pod.Annotations = map[string]string{common.IstioRevLabel: rev}
+		}
+		return pod
+	}
+
+	names := func(pods []metav1.PartialObjectMetadata) []string {
+		var names []string
+		for _, pod := range pods {
+			names = append(names, pod.Namespace+"/"+pod.Name)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		client = fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithObjects(
+				newPod("a", "old", "1-22-0"),
+				newPod("a", "new", "1-23-0"),
+				newPod("a", "plain", ""),
+				newPod("b", "old", "1-22-0"),
+			).
+			WithIndex(NewPodMetadata(), PodIstioRevIndex, podIstioRevIndexValues).
+			Build()
+	})
+
+	It("should find pods by the revision of their sidecars", func() {
+		pods, err := ListPodsWithRev(ctx, client, "a", "1-22-0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(pods)).To(ConsistOf("a/old"))
+
+		pods, err = ListPodsWithRev(ctx, client, "", "1-22-0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(pods)).To(ConsistOf("a/old", "b/old"))
+	})
+
+	It("should find every pod with a sidecar", func() {
+		pods, err := ListInjectedPods(ctx, client, "a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(pods)).To(ConsistOf("a/old", "a/new"))
+	})
+})
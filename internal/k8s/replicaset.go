@@ -0,0 +1,88 @@
+package k8s
+
+// ReplicaSets that aren't managed by a Deployment can't be rollout-restarted: changing their pod
+// template only affects pods created afterwards. They do recreate pods that go away though, so
+// we evict their outdated pods instead. Pods without any controller are a different story, since
+// nothing will bring them back once they're deleted.
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DoReplicaSetRestart evicts outdated pods of a standalone ReplicaSet, keeping no more than
+// maxTerminating of its pods terminating at once. It is meant to be called repeatedly; it returns
+// true once no outdated pods remain.
+func DoReplicaSetRestart(ctx context.Context, client ctrlclient.Client, evictor *Evictor, obj *unstructured.Unstructured,
+	isOutdated func(metav1.PartialObjectMetadata) bool, maxTerminating int, dryRun bool) (bool, error) {
+	if obj.GetKind() != "ReplicaSet" {
+		return false, fmt.Errorf("unsupported Kind %v for ReplicaSet restart", obj.GetKind())
+	}
+	return EvictControllerPods(ctx, client, evictor, obj, isOutdated, maxTerminating, dryRun)
+}
+
+// DeleteBarePod deletes a pod that has no controller. Nothing will recreate it, so this should only
+// be done where that's been explicitly allowed.
+func DeleteBarePod(ctx context.Context, client ctrlclient.Client, pod metav1.PartialObjectMetadata, dryRun bool) error {
+	log := log.FromContext(ctx)
+
+	if dryRun {
+		log.Info("Dry Run Mode: Not Deleting Bare Pod", "ns", pod.Namespace, "pod", pod.Name)
+		return nil
+	}
+
+	log.Info("Deleting outdated bare pod", "ns", pod.Namespace, "pod", pod.Name)
+	err := client.Delete(ctx, podStub(pod), ctrlclient.Preconditions{UID: &pod.UID})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// replicaSetRestarter restarts ReplicaSets that aren't managed by a Deployment
+type replicaSetRestarter struct{}
+
+func (replicaSetRestarter) CanRestart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, string) {
+	return true, ""
+}
+
+func (replicaSetRestarter) IsRolloutComplete(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	// a ReplicaSet doesn't roll anything out, but we only evict more pods once it has replaced
+	// the ones we already evicted
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "readyReplicas")
+	return ready >= replicas, nil
+}
+
+func (replicaSetRestarter) Restart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, error) {
+	done, err := DoReplicaSetRestart(ctx, req.Client, req.Evictor, obj, req.IsOutdated, req.MaxTerminating, req.DryRun)
+	return !done, err
+}
+
+// barePodRestarter handles pods without a controller, which are their own "controller"
+type barePodRestarter struct{}
+
+func (barePodRestarter) CanRestart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, string) {
+	if !req.AllowBarePodDeletion {
+		return false, "Outdated pod has no controller to recreate it and must be restarted manually. " +
+			"Annotate the namespace to allow deleting it."
+	}
+	return true, ""
+}
+
+func (barePodRestarter) IsRolloutComplete(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	return true, nil
+}
+
+func (barePodRestarter) Restart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, error) {
+	return false, DeleteBarePod(ctx, req.Client, req.Pod, req.DryRun)
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/hercynium/istio-fortsa/internal/common"
+)
+
+var _ = Describe("Standalone ReplicaSets and bare pods", func() {
+	var ctx = context.Background()
+	var isController = true
+
+	var client ctrlclient.Client
+	var evictions map[string]int
+
+	newPod := func(name, rev string, owner metav1.Object) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns", Name: name, UID: types.UID(name + "-uid"),
+			Labels:      map[string]string{"app": "web"},
+			Annotations: map[string]string{common.IstioRevLabel: rev},
+		}}
+		if owner != nil {
+			pod.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "ReplicaSet", Name: owner.GetName(), UID: owner.GetUID(), Controller: &isController,
+			}}
+		}
+		return pod
+	}
+
+	isOutdated := func(pod metav1.PartialObjectMetadata) bool {
+		return pod.Annotations[common.IstioRevLabel] != "new"
+	}
+
+	build := func(objs ...ctrlclient.Object) {
+		evictions = make(map[string]int)
+		client = fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithObjects(objs...).
+			WithInterceptorFuncs(interceptor.Funcs{
+				SubResourceCreate: func(ctx context.Context, c ctrlclient.Client, subResource string,
+					obj ctrlclient.Object, sub ctrlclient.Object, opts ...ctrlclient.SubResourceCreateOption) error {
+					Expect(subResource).To(Equal("eviction"))
+					evictions[obj.GetName()]++
+					return nil
+				},
+			}).
+			Build()
+	}
+
+	lookup := func(gvk schema.GroupVersionKind) Restarter {
+		restarter, ok := DefaultRestarters.Lookup(gvk)
+		Expect(ok).To(BeTrue())
+		return restarter
+	}
+
+	It("should evict the outdated pods of a standalone ReplicaSet", func() {
+		var replicas int32 = 2
+		rs := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web", UID: types.UID("rs-uid")},
+			Spec: appsv1.ReplicaSetSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			},
+			Status: appsv1.ReplicaSetStatus{ReadyReplicas: 2},
+		}
+		build(rs, newPod("web-old", "old", rs), newPod("web-new", "new", rs))
+
+		raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(rs)
+		Expect(err).NotTo(HaveOccurred())
+		obj := &unstructured.Unstructured{Object: raw}
+		obj.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("ReplicaSet"))
+
+		restarter := lookup(obj.GroupVersionKind())
+		complete, err := restarter.IsRolloutComplete(ctx, obj)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(complete).To(BeTrue())
+
+		inProgress, err := restarter.Restart(ctx, obj, RestartRequest{
+			Client: client, Evictor: NewEvictor(client, 5), MaxTerminating: 5, IsOutdated: isOutdated,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(evictions).To(Equal(map[string]int{"web-old": 1}))
+
+		// no more are evicted until the ReplicaSet has replaced the evicted pod
+		Expect(unstructured.SetNestedField(obj.Object, int64(1), "status", "readyReplicas")).To(Succeed())
+		complete, err = restarter.IsRolloutComplete(ctx, obj)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(complete).To(BeFalse())
+	})
+
+	Context("with a bare pod", func() {
+		var pod *corev1.Pod
+		var obj *unstructured.Unstructured
+		var req RestartRequest
+
+		BeforeEach(func() {
+			pod = newPod("bare", "old", nil)
+			build(pod)
+
+			raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+			Expect(err).NotTo(HaveOccurred())
+			obj = &unstructured.Unstructured{Object: raw}
+			obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Pod"))
+			req = RestartRequest{Client: client, Pod: metav1.PartialObjectMetadata{ObjectMeta: pod.ObjectMeta}, IsOutdated: isOutdated}
+		})
+
+		It("should leave it alone unless its namespace allows deleting it", func() {
+			canRestart, reason := lookup(obj.GroupVersionKind()).CanRestart(ctx, obj, req)
+			Expect(canRestart).To(BeFalse())
+			Expect(reason).To(ContainSubstring("must be restarted manually"))
+			Expect(client.Get(ctx, ctrlclient.ObjectKeyFromObject(pod), &corev1.Pod{})).To(Succeed())
+		})
+
+		It("should delete it if its namespace allows it", func() {
+			req.AllowBarePodDeletion = true
+			restarter := lookup(obj.GroupVersionKind())
+			canRestart, _ := restarter.CanRestart(ctx, obj, req)
+			Expect(canRestart).To(BeTrue())
+
+			inProgress, err := restarter.Restart(ctx, obj, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inProgress).To(BeFalse())
+			err = client.Get(ctx, ctrlclient.ObjectKeyFromObject(pod), &corev1.Pod{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			Expect(evictions).To(BeEmpty())
+		})
+
+		It("should only report deleting it in a dry run", func() {
+			Expect(DeleteBarePod(ctx, client, req.Pod, true)).To(Succeed())
+			Expect(client.Get(ctx, ctrlclient.ObjectKeyFromObject(pod), &corev1.Pod{})).To(Succeed())
+		})
+	})
+})
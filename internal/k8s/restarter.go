@@ -0,0 +1,108 @@
+package k8s
+
+// Every kind of pod controller we can restart has a Restarter, registered by GVK. The reconciler
+// finds the controller of an outdated pod, looks up the restarter for its kind, and leaves the
+// details of how to restart it and how to tell when it's done to the restarter.
+
+import (
+	"context"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Restarter restarts the pods of one kind of pod controller
+type Restarter interface {
+	// CanRestart returns false, and the reason why, if restarting the controller wouldn't replace
+	// the outdated pod or isn't allowed, for example because of how the controller is configured.
+	CanRestart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, string)
+
+	// IsRolloutComplete returns false while the controller is still rolling out pods, from a
+	// previous restart or anything else. Controllers aren't restarted while this is false.
+	IsRolloutComplete(ctx context.Context, obj *unstructured.Unstructured) (bool, error)
+
+	// Restart restarts the controller's outdated pods. It returns true if the restart is done in
+	// steps, or needs tracking until it completes, and the pod's namespace should be reconciled
+	// again to continue.
+	Restart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, error)
+}
+
+// RestartRequest holds what a Restarter needs to know to restart a controller
+type RestartRequest struct {
+	Client  ctrlclient.Client
+	Evictor *Evictor
+
+	// the outdated pod that led us to the controller
+	Pod metav1.PartialObjectMetadata
+
+	// returns true for pods running an outdated sidecar
+	IsOutdated func(metav1.PartialObjectMetadata) bool
+
+	// don't change anything, only report what would be done
+	DryRun bool
+
+	// when evicting or deleting pods, allow no more than this many to be terminating at once
+	MaxTerminating int
+
+	// delete outdated pods of controllers with the OnDelete update strategy
+	OnDeletePodRestart bool
+
+	// delete outdated pods that have no controller
+	AllowBarePodDeletion bool
+}
+
+// RestarterRegistry holds Restarters keyed by the GVK of the controllers they restart
+type RestarterRegistry struct {
+	mu         sync.RWMutex
+	restarters map[schema.GroupVersionKind]Restarter
+}
+
+// NewRestarterRegistry returns an empty registry
+func NewRestarterRegistry() *RestarterRegistry {
+	return &RestarterRegistry{restarters: make(map[schema.GroupVersionKind]Restarter)}
+}
+
+// Register sets the Restarter for a GVK, replacing any already registered
+func (r *RestarterRegistry) Register(gvk schema.GroupVersionKind, restarter Restarter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.restarters[gvk] = restarter
+}
+
+// Lookup returns the Restarter registered for a GVK, if there is one
+func (r *RestarterRegistry) Lookup(gvk schema.GroupVersionKind) (Restarter, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	restarter, ok := r.restarters[gvk]
+	return restarter, ok
+}
+
+// Clone returns a copy of the registry, which can be changed without affecting the original
+func (r *RestarterRegistry) Clone() *RestarterRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var clone = NewRestarterRegistry()
+	for gvk, restarter := range r.restarters {
+		clone.restarters[gvk] = restarter
+	}
+	return clone
+}
+
+// DefaultRestarters holds the built-in restarters, and any registered by programs embedding fortsa
+var DefaultRestarters = NewRestarterRegistry()
+
+func init() {
+	DefaultRestarters.Register(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, rolloutRestarter{})
+	DefaultRestarters.Register(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "DaemonSet"}, rolloutRestarter{})
+	DefaultRestarters.Register(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"}, rolloutRestarter{})
+	DefaultRestarters.Register(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}, replicaSetRestarter{})
+	DefaultRestarters.Register(schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"}, barePodRestarter{})
+	DefaultRestarters.Register(ArgoRolloutGVK, argoRolloutRestarter{})
+	DefaultRestarters.Register(KruiseCloneSetGVK, kruiseRestarter{})
+	DefaultRestarters.Register(KruiseStatefulSetGVK, kruiseRestarter{})
+	DefaultRestarters.Register(KruiseStatefulSetGVK.GroupKind().WithVersion("v1alpha1"), kruiseRestarter{})
+	DefaultRestarters.Register(KruiseDaemonSetGVK, kruiseRestarter{})
+}
@@ -4,11 +4,11 @@ package k8s
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
 	"time"
 
-	appsv1 "k8s.io/api/apps/v1"
-	"k8s.io/apimachinery/pkg/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
@@ -27,73 +27,102 @@ const (
 //+kubebuilder:rbac:groups=apps,resources=statefulset;statefulsets,verbs=get;list;watch;update;patch
 
 // DoRolloutRestart handles rollout restart of object by patching with annotation
-// TODO: if annotation exists, check status. If rollout failed in some way, report it.
-func DoRolloutRestart(ctx context.Context, client ctrlclient.Client, obj ctrlclient.Object, dryRun bool) error {
+func DoRolloutRestart(ctx context.Context, client ctrlclient.Client, obj *unstructured.Unstructured, dryRun bool) error {
+	return patchRestartAnnotation(ctx, client, obj, defaultAnnotationsPath, dryRun)
+}
+
+// patchRestartAnnotation sets our restart annotation, with the current time, in the annotations
+// found at the given dot-separated path in the object, using a merge patch
+func patchRestartAnnotation(ctx context.Context, client ctrlclient.Client, obj *unstructured.Unstructured,
+	annotationsPath string, dryRun bool) error {
 	log := log.FromContext(ctx)
-	log.Info("Attempting rollout restart", "obj", obj.GetName(), "kind", obj.GetObjectKind(), "ns", obj.GetNamespace())
+	log.Info("Attempting rollout restart", "obj", obj.GetName(), "kind", obj.GetKind(), "ns", obj.GetNamespace())
+
+	if dryRun {
+		log.Info("Dry Run Mode: Not Patching Resource",
+			"ns", obj.GetNamespace(), "podController", obj.GetName(), "podControllerKind", obj.GetKind())
+		return nil
+	}
+
+	// build the patch from the inside out: { spec: { template: { ... { annotation: time } } } }
+	var patchObj any = map[string]string{RolloutRestartAnnotation: time.Now().Format(time.RFC3339)}
+	fields := splitPath(annotationsPath)
+	for i := len(fields) - 1; i >= 0; i-- {
+		patchObj = map[string]any{fields[i]: patchObj}
+	}
+	patch, err := json.Marshal(patchObj)
+	if err != nil {
+		return err
+	}
+	return client.Patch(ctx, obj, ctrlclient.RawPatch(ctrlclient.Merge.Type(), patch))
+}
+
+// restartedSince returns true if we restarted the object, going by the restart annotation at the
+// given path, after the pod was created. If the object has since finished rolling out and the pod
+// is still there, it was deliberately left alone (for example by a partition), and restarting the
+// object again won't replace it.
+func restartedSince(obj *unstructured.Unstructured, annotationsPath string, pod metav1.PartialObjectMetadata) bool {
+	fields := append(splitPath(annotationsPath), RolloutRestartAnnotation)
+	value, _, _ := unstructured.NestedString(obj.Object, fields...)
+	restartedAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return false
+	}
+	return pod.CreationTimestamp.Time.Before(restartedAt)
+}
+
+// rolloutRestarter restarts Deployments, DaemonSets and StatefulSets
+type rolloutRestarter struct{}
+
+func (rolloutRestarter) CanRestart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, string) {
+	if IsOnDeleteStrategy(obj) && !req.OnDeletePodRestart {
+		return false, "Controller uses the OnDelete update strategy, so a rollout restart won't replace its pods. " +
+			"Enable OnDeletePodRestart to have its outdated pods deleted one at a time."
+	}
+	return true, ""
+}
 
-	restartTimeInNanos := time.Now().Format(time.RFC3339)
+func (rolloutRestarter) IsRolloutComplete(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	observedGeneration, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if observedGeneration < obj.GetGeneration() {
+		return false, nil
+	}
 
-	// TODO: figure out how to DRY this code
-	switch obj.GetObjectKind().GroupVersionKind().Kind {
+	status := func(field string) int64 {
+		value, _, _ := unstructured.NestedInt64(obj.Object, "status", field)
+		return value
+	}
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+
+	switch obj.GetKind() {
 	case "Deployment":
-		objX := &appsv1.Deployment{}
-		err := client.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}, objX)
-		if err != nil {
-			return err
-		}
-		// TODO: check the annotation and if it exists, check the timestamp. If it's been less than 1 hour,
-		// skip updating it to trigger another restart attempt
-		patch := ctrlclient.StrategicMergeFrom(objX.DeepCopy())
-		if !dryRun {
-			if objX.Spec.Template.Annotations == nil {
-				objX.Spec.Template.Annotations = make(map[string]string)
-			}
-			objX.Spec.Template.Annotations[RolloutRestartAnnotation] = restartTimeInNanos
-		} else {
-			log.Info("Dry Run Mode: Not Patching Resource",
-				"ns", objX.Namespace, "podController", objX.Name, "podControllerKind", objX.Kind)
-		}
-		return client.Patch(ctx, objX, patch)
-	case "DaemonSet":
-		objX := &appsv1.DaemonSet{}
-		err := client.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}, objX)
-		if err != nil {
-			return err
-		}
-		// TODO: check the annotation and if it exists, check the timestamp. If it's been less than 1 hour,
-		// skip updating it to trigger another restart attempt
-		patch := ctrlclient.StrategicMergeFrom(objX.DeepCopy())
-		if !dryRun {
-			if objX.Spec.Template.Annotations == nil {
-				objX.Spec.Template.Annotations = make(map[string]string)
-			}
-			objX.Spec.Template.Annotations[RolloutRestartAnnotation] = restartTimeInNanos
-		} else {
-			log.Info("Dry Run Mode: Not Patching Resource",
-				"ns", objX.Namespace, "podController", objX.Name, "podControllerKind", objX.Kind)
-		}
-		return client.Patch(ctx, objX, patch)
+		return status("updatedReplicas") >= replicas && status("availableReplicas") >= replicas &&
+			status("replicas") <= replicas, nil
 	case "StatefulSet":
-		objX := &appsv1.StatefulSet{}
-		err := client.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}, objX)
-		if err != nil {
-			return err
+		if IsOnDeleteStrategy(obj) {
+			// pods are only updated when we delete them, so just wait for them to be ready
+			return status("replicas") == replicas && status("readyReplicas") >= replicas, nil
 		}
-		// TODO: check the annotation and if it exists, check the timestamp. If it's been less than 1 hour,
-		// skip updating it to trigger another restart attempt
-		patch := ctrlclient.StrategicMergeFrom(objX.DeepCopy())
-		if !dryRun {
-			if objX.Spec.Template.Annotations == nil {
-				objX.Spec.Template.Annotations = make(map[string]string)
-			}
-			objX.Spec.Template.Annotations[RolloutRestartAnnotation] = restartTimeInNanos
-		} else {
-			log.Info("Dry Run Mode: Not Patching Resource",
-				"ns", objX.Namespace, "podController", objX.Name, "podControllerKind", objX.Kind)
+		return status("updatedReplicas") >= replicas && status("readyReplicas") >= replicas, nil
+	case "DaemonSet":
+		desired := status("desiredNumberScheduled")
+		if IsOnDeleteStrategy(obj) {
+			return status("numberReady") >= desired && status("numberUnavailable") == 0, nil
 		}
-		return client.Patch(ctx, objX, patch)
+		return status("updatedNumberScheduled") >= desired && status("numberAvailable") >= desired, nil
 	default:
-		return fmt.Errorf("unsupported Kind %v for rollout restart", obj.GetObjectKind().GroupVersionKind().Kind)
+		return true, nil
+	}
+}
+
+func (rolloutRestarter) Restart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, error) {
+	// a rollout restart does nothing for controllers that only replace pods when they're deleted
+	if IsOnDeleteStrategy(obj) {
+		done, err := DoOnDeleteRestart(ctx, req.Client, obj, req.IsOutdated, req.DryRun)
+		return !done, err
 	}
+	return false, DoRolloutRestart(ctx, req.Client, obj, req.DryRun)
 }
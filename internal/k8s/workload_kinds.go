@@ -0,0 +1,107 @@
+package k8s
+
+// Kinds of pod controllers fortsa doesn't know about, like those of in-house operators, can be
+// described in the config file. As long as annotating the pod template makes the controller roll
+// its pods, we can restart them with a plain merge patch on the unstructured object.
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/hercynium/istio-fortsa/internal/config"
+)
+
+// where pod template annotations live in most workload kinds
+const defaultAnnotationsPath = "spec.template.metadata.annotations"
+
+// RegisterWorkloadKinds validates the configured workload kinds and registers a Restarter for each
+// of them, replacing any restarter already registered for the same GVK
+func RegisterWorkloadKinds(registry *RestarterRegistry, kinds []config.WorkloadKind) error {
+	var seen = make(map[schema.GroupVersionKind]bool)
+	for _, wk := range kinds {
+		if wk.Version == "" || wk.Kind == "" {
+			return fmt.Errorf("workload kind %q in group %q needs both a version and a kind", wk.Kind, wk.Group)
+		}
+		if wk.AnnotationsPath == "" {
+			wk.AnnotationsPath = defaultAnnotationsPath
+		}
+		gvk := schema.GroupVersionKind{Group: wk.Group, Version: wk.Version, Kind: wk.Kind}
+		if seen[gvk] {
+			return fmt.Errorf("workload kind %v is configured more than once", gvk)
+		}
+		seen[gvk] = true
+		registry.Register(gvk, workloadKindRestarter{kind: wk})
+	}
+	return nil
+}
+
+// workloadKindRestarter restarts workloads of a kind described in the config file
+type workloadKindRestarter struct {
+	kind config.WorkloadKind
+}
+
+func (w workloadKindRestarter) CanRestart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, string) {
+	if w.kind.Completion.IsTracked() && IsWorkloadKindRolloutComplete(w.kind, obj) &&
+		restartedSince(obj, w.kind.AnnotationsPath, req.Pod) {
+		return false, "Workload finished rolling out without replacing this pod, not restarting it again"
+	}
+	return true, ""
+}
+
+func (w workloadKindRestarter) IsRolloutComplete(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	return IsWorkloadKindRolloutComplete(w.kind, obj), nil
+}
+
+func (w workloadKindRestarter) Restart(ctx context.Context, obj *unstructured.Unstructured, req RestartRequest) (bool, error) {
+	// only check back if there's a way to tell when the restart is done
+	var track = w.kind.Completion.IsTracked() && !req.DryRun
+	return track, patchRestartAnnotation(ctx, req.Client, obj, w.kind.AnnotationsPath, req.DryRun)
+}
+
+// IsWorkloadKindRolloutComplete returns true if every completion check configured for the
+// workload kind passes. Kinds without any checks are always considered complete.
+func IsWorkloadKindRolloutComplete(wk config.WorkloadKind, obj *unstructured.Unstructured) bool {
+	var c = wk.Completion
+
+	if c.ObservedGenerationPath != "" {
+		observed, _, _ := unstructured.NestedInt64(obj.Object, splitPath(c.ObservedGenerationPath)...)
+		if observed < obj.GetGeneration() {
+			return false
+		}
+	}
+
+	var first string
+	for i, path := range c.EqualFields {
+		value := fieldString(obj, path)
+		if i == 0 {
+			first = value
+		} else if value != first {
+			return false
+		}
+	}
+
+	for _, expected := range c.ExpectedFields {
+		if fieldString(obj, expected.Path) != expected.Value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fieldString returns the value of a field as a string, whatever its type, or "" if it's not set
+func fieldString(obj *unstructured.Unstructured, path string) string {
+	value, found, err := unstructured.NestedFieldNoCopy(obj.Object, splitPath(path)...)
+	if err != nil || !found || value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "."), ".")
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/hercynium/istio-fortsa/internal/config"
+)
+
+var _ = Describe("Workload kinds", func() {
+	var webApp = config.WorkloadKind{
+		Group:   "example.com",
+		Version: "v1",
+		Kind:    "WebApp",
+		Completion: config.WorkloadCompletion{
+			ObservedGenerationPath: "status.observedGeneration",
+			EqualFields:            []string{"status.updatedReplicas", "spec.replicas"},
+			ExpectedFields:         []config.ExpectedField{{Path: "status.phase", Value: "Ready"}},
+		},
+	}
+
+	newWebApp := func(generation, observed, replicas, updated int64, phase string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]any{
+			"spec": map[string]any{"replicas": replicas},
+			"status": map[string]any{
+				"observedGeneration": observed,
+				"updatedReplicas":    updated,
+				"phase":              phase,
+			},
+		}}
+		obj.SetGeneration(generation)
+		return obj
+	}
+
+	Context("When registering workload kinds", func() {
+		It("should register a restarter with the default annotations path", func() {
+			registry := NewRestarterRegistry()
+			Expect(RegisterWorkloadKinds(registry, []config.WorkloadKind{webApp})).To(Succeed())
+
+			restarter, ok := registry.Lookup(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "WebApp"})
+			Expect(ok).To(BeTrue())
+			Expect(restarter).To(BeAssignableToTypeOf(workloadKindRestarter{}))
+			Expect(restarter.(workloadKindRestarter).kind.AnnotationsPath).To(Equal("spec.template.metadata.annotations"))
+		})
+
+		It("should reject duplicate and incomplete entries", func() {
+			Expect(RegisterWorkloadKinds(NewRestarterRegistry(), []config.WorkloadKind{webApp, webApp})).NotTo(Succeed())
+
+			incomplete := []config.WorkloadKind{{Group: "example.com", Kind: "WebApp"}}
+			Expect(RegisterWorkloadKinds(NewRestarterRegistry(), incomplete)).NotTo(Succeed())
+		})
+
+		It("should take precedence over built-in restarters", func() {
+			deployment := config.WorkloadKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+			registry := DefaultRestarters.Clone()
+			Expect(RegisterWorkloadKinds(registry, []config.WorkloadKind{deployment})).To(Succeed())
+
+			restarter, ok := registry.Lookup(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+			Expect(ok).To(BeTrue())
+			Expect(restarter).To(BeAssignableToTypeOf(workloadKindRestarter{}))
+
+			// the original is left alone
+			restarter, _ = DefaultRestarters.Lookup(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+			Expect(restarter).To(BeAssignableToTypeOf(rolloutRestarter{}))
+		})
+	})
+
+	Context("When checking rollout completion", func() {
+		It("should be complete when every check passes", func() {
+			Expect(IsWorkloadKindRolloutComplete(webApp, newWebApp(2, 2, 3, 3, "Ready"))).To(BeTrue())
+		})
+
+		It("should not be complete until the new generation is observed", func() {
+			Expect(IsWorkloadKindRolloutComplete(webApp, newWebApp(3, 2, 3, 3, "Ready"))).To(BeFalse())
+		})
+
+		It("should not be complete while fields differ", func() {
+			Expect(IsWorkloadKindRolloutComplete(webApp, newWebApp(2, 2, 3, 1, "Ready"))).To(BeFalse())
+			Expect(IsWorkloadKindRolloutComplete(webApp, newWebApp(2, 2, 3, 3, "Progressing"))).To(BeFalse())
+		})
+	})
+
+	Context("When checking for an earlier restart", func() {
+		It("should follow the configured annotations path", func() {
+			obj := &unstructured.Unstructured{Object: map[string]any{}}
+			Expect(unstructured.SetNestedField(obj.Object, "2025-01-01T00:00:00Z",
+				"spec", "podTemplate", "metadata", "annotations", RolloutRestartAnnotation)).To(Succeed())
+
+			pod := metav1.PartialObjectMetadata{}
+			pod.CreationTimestamp = metav1.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)
+			Expect(restartedSince(obj, "spec.podTemplate.metadata.annotations", pod)).To(BeTrue())
+			Expect(restartedSince(obj, defaultAnnotationsPath, pod)).To(BeFalse())
+
+			pod.CreationTimestamp = metav1.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+			Expect(restartedSince(obj, "spec.podTemplate.metadata.annotations", pod)).To(BeFalse())
+		})
+	})
+})
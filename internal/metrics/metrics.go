@@ -0,0 +1,71 @@
+// Package metrics holds fortsa's Prometheus metrics. They're registered with controller-runtime's
+// registry, so they're served by the manager's metrics endpoint along with its own.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// MisconfiguredNamespaces is 1 for each namespace whose istio label doesn't lead to an istio
+	// revision, so its pods would come back without a sidecar if restarted
+	MisconfiguredNamespaces = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fortsa_misconfigured_namespace",
+		Help: "Namespaces whose istio.io/rev label doesn't lead to any istio revision",
+	}, []string{"namespace", "label", "reason"})
+
+	// OrphanedProxies counts the pods in each namespace running sidecars of an istio revision
+	// that has neither a webhook nor an istiod anymore, so they get no config updates
+	OrphanedProxies = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "fortsa_orphaned_proxies",
+		Help:        "Pods running sidecars of an istio revision whose control plane is gone",
+		ConstLabels: prometheus.Labels{"severity": "critical"},
+	}, []string{"namespace", "revision"})
+
+	// OutdatedBarePods counts the outdated pods in each namespace that have no controller to
+	// recreate them, and that the namespace doesn't allow deleting
+	OutdatedBarePods = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fortsa_outdated_bare_pods",
+		Help: "Outdated pods without a controller, which must be restarted manually",
+	}, []string{"namespace"})
+
+	// RevisionUsers counts what still uses each installed istio revision, so it's known when the
+	// revision can be uninstalled
+	RevisionUsers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fortsa_revision_users",
+		Help: "Pods, workloads, namespaces and tags still using each installed istio revision",
+	}, []string{"revision", "kind"})
+
+	// SkewedWorkloads is how many minor versions the sidecars of each workload are out of the
+	// supported skew from their control plane
+	SkewedWorkloads = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fortsa_proxy_skew_out_of_support",
+		Help: "Minor versions each workload's sidecars are outside the skew istio supports from their control plane",
+	}, []string{"namespace", "kind", "name", "proxy_version", "control_plane_version"})
+
+	// VulnerableProxies counts the pods in each namespace running sidecars affected by each
+	// security advisory
+	VulnerableProxies = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fortsa_vulnerable_proxies",
+		Help: "Pods running sidecars of an istio version affected by a security advisory",
+	}, []string{"namespace", "advisory", "severity", "proxy_version"})
+
+	// CampaignWorkloads counts the workloads of each campaign moving an istio tag to another
+	// revision, by their state in it
+	CampaignWorkloads = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fortsa_campaign_workloads",
+		Help: "Workloads of each campaign moving an istio tag between revisions, by state",
+	}, []string{"campaign", "tag", "source", "target", "state"})
+
+	// CampaignETA is when each campaign under way should be done, at the current restart rate
+	CampaignETA = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fortsa_campaign_eta_timestamp_seconds",
+		Help: "When each campaign under way should be done, as a Unix timestamp",
+	}, []string{"campaign"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(MisconfiguredNamespaces, OrphanedProxies, OutdatedBarePods, RevisionUsers, SkewedWorkloads,
+		VulnerableProxies, CampaignWorkloads, CampaignETA)
+}
@@ -0,0 +1,82 @@
+// Package status keeps a board of what fortsa has found out about the cluster, like misconfigured
+// namespaces, and serves it as JSON. The board is served on the manager's metrics endpoint, so
+// it's protected the same way the metrics are.
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Path the board is served on
+const Path = "/status"
+
+// Board holds findings in named sections, each keyed by what the finding is about. It is safe for
+// concurrent use.
+type Board struct {
+	mu       sync.RWMutex
+	sections map[string]map[string]any
+}
+
+// NewBoard returns an empty board
+func NewBoard() *Board {
+	return &Board{sections: make(map[string]map[string]any)}
+}
+
+// Set sets the finding for a key in a section, replacing any already there
+func (b *Board) Set(section, key string, finding any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sections[section] == nil {
+		b.sections[section] = make(map[string]any)
+	}
+	b.sections[section][key] = finding
+}
+
+// Delete removes the finding for a key in a section
+func (b *Board) Delete(section, key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.sections[section], key)
+}
+
+// Replace replaces all the findings in a section
+func (b *Board) Replace(section string, findings map[string]any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var copied = make(map[string]any, len(findings))
+	for key, finding := range findings {
+		copied[key] = finding
+	}
+	b.sections[section] = copied
+}
+
+// Get returns the finding for a key in a section, if there is one
+func (b *Board) Get(section, key string) (any, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	finding, ok := b.sections[section][key]
+	return finding, ok
+}
+
+// ServeHTTP serves every section of the board as a JSON object, or only the one named by the
+// "section" query parameter
+func (b *Board) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var body any = b.sections
+	if section := req.URL.Query().Get("section"); section != "" {
+		findings, ok := b.sections[section]
+		if !ok {
+			findings = map[string]any{}
+		}
+		body = findings
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,113 @@
+// Package version reads istio versions out of revision names, like 1-23-2 or canary-1-24, and
+// out of proxy image tags, like docker.io/istio/proxyv2:1.23.2-distroless, so revision changes
+// can be told apart as upgrades or downgrades.
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is an istio version. Revision names often leave out the patch version.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+
+	// the patch version was given
+	HasPatch bool
+}
+
+// major, minor and optional patch numbers, separated by dashes in revision names and by dots in
+// image tags
+var versionPattern = regexp.MustCompile(`(?:^|[^0-9])([0-9]+)[-.]([0-9]+)(?:[-.]([0-9]+))?(?:[^0-9]|$)`)
+
+// Parse finds the first version in the string, if there is one
+func Parse(s string) (Version, bool) {
+	var match = versionPattern.FindStringSubmatch(s)
+	if match == nil {
+		return Version{}, false
+	}
+	var v Version
+	v.Major, _ = strconv.Atoi(match[1])
+	v.Minor, _ = strconv.Atoi(match[2])
+	if match[3] != "" {
+		v.Patch, _ = strconv.Atoi(match[3])
+		v.HasPatch = true
+	}
+	return v, true
+}
+
+// FromImage returns the version in an image's tag, if it has one
+func FromImage(image string) (Version, bool) {
+	// digests don't tell us anything
+	image, _, _ = strings.Cut(image, "@")
+	var slash = strings.LastIndex(image, "/")
+	var colon = strings.LastIndex(image, ":")
+	if colon <= slash {
+		return Version{}, false
+	}
+	return Parse(image[colon+1:])
+}
+
+func (v Version) String() string {
+	if !v.HasPatch {
+		return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+	}
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1, 0 or 1 if v is older than, the same as, or newer than o. Patch versions are
+// only compared if both versions have one.
+func (v Version) Compare(o Version) int {
+	switch {
+	case v.Major != o.Major:
+		return compareInts(v.Major, o.Major)
+	case v.Minor != o.Minor:
+		return compareInts(v.Minor, o.Minor)
+	case v.HasPatch && o.HasPatch:
+		return compareInts(v.Patch, o.Patch)
+	default:
+		return 0
+	}
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Change is the kind of change moving from one version to another
+type Change string
+
+const (
+	Same         Change = "Same"
+	PatchUpgrade Change = "PatchUpgrade"
+	MinorUpgrade Change = "MinorUpgrade"
+	MajorUpgrade Change = "MajorUpgrade"
+	Downgrade    Change = "Downgrade"
+)
+
+// Classify returns the kind of change moving from one version to another is
+func Classify(from, to Version) Change {
+	switch {
+	case to.Compare(from) < 0:
+		return Downgrade
+	case to.Major != from.Major:
+		return MajorUpgrade
+	case to.Minor != from.Minor:
+		return MinorUpgrade
+	case to.Compare(from) > 0:
+		return PatchUpgrade
+	default:
+		return Same
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package version
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Version", func() {
+	DescribeTable("parsing revision names",
+		func(s string, expected Version, ok bool) {
+			v, found := Parse(s)
+			Expect(found).To(Equal(ok))
+			Expect(v).To(Equal(expected))
+		},
+		Entry("full revision", "1-23-2", Version{Major: 1, Minor: 23, Patch: 2, HasPatch: true}, true),
+		Entry("minor revision", "1-24", Version{Major: 1, Minor: 24}, true),
+		Entry("prefixed revision", "canary-1-24-0", Version{Major: 1, Minor: 24, Patch: 0, HasPatch: true}, true),
+		Entry("dotted version", "1.22.5", Version{Major: 1, Minor: 22, Patch: 5, HasPatch: true}, true),
+		Entry("named revision", "stable", Version{}, false),
+	)
+
+	DescribeTable("parsing proxy images",
+		func(image string, expected Version, ok bool) {
+			v, found := FromImage(image)
+			Expect(found).To(Equal(ok))
+			Expect(v).To(Equal(expected))
+		},
+		Entry("tagged", "docker.io/istio/proxyv2:1.23.2", Version{Major: 1, Minor: 23, Patch: 2, HasPatch: true}, true),
+		Entry("distroless", "gcr.io/istio-release/proxyv2:1.22.0-distroless", Version{Major: 1, Minor: 22, HasPatch: true}, true),
+		Entry("registry with port", "registry:5000/istio/proxyv2:1.24.1@sha256:abcd", Version{Major: 1, Minor: 24, Patch: 1, HasPatch: true}, true),
+		Entry("untagged", "registry:5000/istio/proxyv2", Version{}, false),
+	)
+
+	DescribeTable("classifying changes",
+		func(from, to string, expected Change) {
+			f, _ := Parse(from)
+			t, _ := Parse(to)
+			Expect(Classify(f, t)).To(Equal(expected))
+		},
+		Entry("patch upgrade", "1-23-1", "1-23-2", PatchUpgrade),
+		Entry("minor upgrade", "1-23-2", "1-24-0", MinorUpgrade),
+		Entry("major upgrade", "1-24-0", "2-0-0", MajorUpgrade),
+		Entry("patch downgrade", "1-23-2", "1-23-1", Downgrade),
+		Entry("minor downgrade", "1-24", "1-23-9", Downgrade),
+		Entry("no patch to compare", "1-23", "1-23-4", Same),
+	)
+})
@@ -0,0 +1,66 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fortsa lets other programs run fortsa inside their own controller manager, and teach it
+// to restart kinds of pod controllers it doesn't know about.
+//
+//	fortsa.RegisterRestarter(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "WebApp"}, myRestarter)
+//	cfg, err := fortsa.LoadConfig()
+//	...
+//	err = fortsa.SetupWithManager(mgr, cfg)
+package fortsa
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/hercynium/istio-fortsa/internal/config"
+	"github.com/hercynium/istio-fortsa/internal/controller"
+	"github.com/hercynium/istio-fortsa/internal/k8s"
+)
+
+// Config is fortsa's configuration
+type Config = config.FortsaConfig
+
+// Restarter restarts the pods of one kind of pod controller
+type Restarter = k8s.Restarter
+
+// RestartRequest holds what a Restarter needs to know to restart a controller
+type RestartRequest = k8s.RestartRequest
+
+// Evictor evicts pods, limiting how many evictions may be in progress at once
+type Evictor = k8s.Evictor
+
+// RegisterRestarter sets the Restarter for controllers of the given GVK, replacing any built-in
+// one. It must be called before SetupWithManager. Kinds described in fortsa's config file still
+// take precedence.
+func RegisterRestarter(gvk schema.GroupVersionKind, restarter Restarter) {
+	k8s.DefaultRestarters.Register(gvk, restarter)
+}
+
+// LoadConfig reads fortsa's configuration from the environment and the optional config file
+func LoadConfig() (Config, error) {
+	return config.GetConfig()
+}
+
+// SetupWithManager adds fortsa's controller to the manager
+func SetupWithManager(mgr ctrl.Manager, cfg Config) error {
+	return (&controller.NamespaceReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Config: cfg,
+	}).SetupWithManager(mgr)
+}